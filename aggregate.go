@@ -0,0 +1,99 @@
+package reqcache
+
+import "context"
+
+// Number is a constraint for the numeric types of the values supported by Increment.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Sum returns the sum of field(value) over all values cached in the current session.
+// Returns 0 if the session has no cached data.
+func Sum[K comparable, T any](ctx context.Context, c *ReqCache[K, T], field func(*T) float64) (float64, error) {
+	var sum float64
+	err := c.Range(ctx, func(_ K, v *T) bool {
+		sum += field(v)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
+
+// Increment adds delta to the value cached for the key in the current session and returns the new value.
+// If there is no value (or it is nil), delta is cached as the value. The read, the addition and the store are done
+// under the cache lock, so concurrent increments of the session are not lost. A missing value is added under
+// the lock of the key (see ValueCache.Update), so concurrent increments of the key create a single object.
+// Returns ErrNoSessionInContext if the context has no session.
+func Increment[K comparable, T Number](ctx context.Context, c *ReqCache[K, T], key K, delta T) (T, error) {
+	c.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = c.checkContext(ctx); err != nil {
+		return 0, err
+	}
+
+	var res T
+	add := func(v *T) bool {
+		if v == nil {
+			return false
+		}
+
+		*v += delta
+		res = *v
+
+		return true
+	}
+
+	effectiveKey := c.effectiveKey(ctx, key)
+	addExisting := func() bool {
+		shard := c.dataShard(requestKey)
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+
+		d, ok := shard.backend(requestKey)
+		if !ok {
+			return false
+		}
+
+		v, found := d.Get(effectiveKey)
+
+		return found && add(v)
+	}
+
+	// usually the key exists, so it is updated under one lock acquisition
+	if addExisting() {
+		return res, nil
+	}
+
+	lock, err := c.keyLock(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	// the key may have been added by a concurrent increment while waiting for the lock
+	if addExisting() {
+		return res, nil
+	}
+
+	obj := c.NewObject(ctx)
+	*obj = delta
+
+	// the key may still be added concurrently by Put, then it is incremented instead
+	if _, loaded := c.store(ctx, key, obj, add); !loaded {
+		res = delta
+	}
+
+	return res, nil
+}
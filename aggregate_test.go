@@ -0,0 +1,128 @@
+package reqcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSum(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](10, 10)
+	field := func(v *reqCacheTestObject) float64 { return float64(v.value) }
+
+	// No session
+	_, err := Sum(context.Background(), cache, field)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// Empty session
+	sum, err := Sum(ctx, cache, field)
+	require.NoError(t, err)
+	require.Zero(t, sum)
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{value: 20}))
+	require.NoError(t, cache.Put(ctx, "key3", &reqCacheTestObject{value: 300}))
+
+	sum, err = Sum(ctx, cache, field)
+	require.NoError(t, err)
+	require.InDelta(t, 321.0, sum, 0)
+}
+
+func TestIncrement(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, int64](10, 10)
+
+	_, err := Increment(context.Background(), cache, "key", 1)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	v, err := Increment(ctx, cache, "key", 5)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, v)
+
+	v, err = Increment(ctx, cache, "key", -2)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, v)
+
+	// Concurrent increments of the same and different keys converge to the correct totals
+	const (
+		nParallel = 20
+		nIncr     = 100
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < nParallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < nIncr; j++ {
+				if _, err := Increment(ctx, cache, "counter", 1); err != nil {
+					panic(err)
+				}
+				if _, err := Increment(ctx, cache, "other", 2); err != nil {
+					panic(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	counter, ok := cache.Get(ctx, "counter")
+	require.True(t, ok)
+	require.EqualValues(t, nParallel*nIncr, *counter)
+
+	other, ok := cache.Get(ctx, "other")
+	require.True(t, ok)
+	require.EqualValues(t, 2*nParallel*nIncr, *other)
+}
+
+func TestIncrement_ConcurrentFirstIncrements(t *testing.T) {
+	t.Parallel()
+
+	const (
+		nKeys     = 50
+		nParallel = 20
+	)
+
+	cache := New[int, int64](nKeys, nKeys)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// Increments of a missing key start together, but only the first of them creates an object
+	for key := 0; key < nKeys; key++ {
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < nParallel; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				<-start
+				if _, err := Increment(ctx, cache, key, 1); err != nil {
+					panic(err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		v, ok := cache.Get(ctx, key)
+		require.True(t, ok)
+		require.EqualValues(t, nParallel, *v)
+	}
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, nKeys, stats.PoolHits+stats.PoolOverflows)
+}
@@ -0,0 +1,64 @@
+package reqcache
+
+import "context"
+
+// AnyCache is a wrapper around ReqCache that stores values of any types under string keys,
+// so a single cache and session bookkeeping can serve all entity types of a request.
+// Type assertions of the returned values are the caller's responsibility.
+type AnyCache struct {
+	cache *ReqCache[string, any]
+}
+
+// NewAny creates a new instance of AnyCache. cacheSize is the size of the cache in a single request.
+// Objects are not preallocated, because the value types are not known in advance.
+func NewAny(cacheSize int, opts ...Option) *AnyCache {
+	return &AnyCache{
+		cache: New[string, any](0, cacheSize, opts...),
+	}
+}
+
+// Put saves the value in the cache.
+func (c *AnyCache) Put(ctx context.Context, key string, value any) error {
+	if _, err := sessionFromContext(ctx); err != nil {
+		return err
+	}
+
+	return c.cache.Put(ctx, key, &value)
+}
+
+// Get returns the value from the cache.
+func (c *AnyCache) Get(ctx context.Context, key string) (any, bool, error) {
+	if _, err := sessionFromContext(ctx); err != nil {
+		return nil, false, err
+	}
+
+	v, ok := c.cache.Get(ctx, key)
+	if !ok || v == nil {
+		return nil, false, nil
+	}
+
+	return *v, true, nil
+}
+
+// Exists checks if the value exists in the cache.
+func (c *AnyCache) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := sessionFromContext(ctx); err != nil {
+		return false, err
+	}
+
+	return c.cache.Exists(ctx, key), nil
+}
+
+// Delete deletes the value from the cache. Returns true if the value existed.
+func (c *AnyCache) Delete(ctx context.Context, key string) (bool, error) {
+	if _, err := sessionFromContext(ctx); err != nil {
+		return false, err
+	}
+
+	return c.cache.Delete(ctx, key), nil
+}
+
+// EndSession deletes the session's values from the cache. See ReqCache.EndSession.
+func (c *AnyCache) EndSession(ctx context.Context) error {
+	return c.cache.EndSession(ctx)
+}
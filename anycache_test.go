@@ -0,0 +1,56 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnyCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewAny(10)
+
+	_, _, err := cache.Get(context.Background(), "user")
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+	require.ErrorIs(t, cache.Put(context.Background(), "user", 1), ErrNoSessionInContext)
+	_, err = cache.Exists(context.Background(), "user")
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+	_, err = cache.Delete(context.Background(), "user")
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "user", &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx, "count", 42))
+
+	v, ok, err := cache.Get(ctx, "user")
+	require.NoError(t, err)
+	require.True(t, ok)
+	user, isUser := v.(*reqCacheTestObject)
+	require.True(t, isUser)
+	require.Equal(t, 1, user.value)
+
+	v, ok, err = cache.Get(ctx, "count")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 42, v)
+
+	_, ok, err = cache.Get(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = cache.Delete(ctx, "count")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = cache.Exists(ctx, "count")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = cache.Exists(ctx, "user")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,204 @@
+package reqcache
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// Backend is a storage of the data cached within a single session.
+// The default implementation is the LRU cache from github.com/hashicorp/golang-lru/v2.
+// Read methods may be called concurrently, so the implementation must be safe for concurrent use.
+type Backend[K comparable, T any] interface {
+	// Add adds a value to the storage. Returns true if an eviction occurred.
+	Add(key K, value *T) (evicted bool)
+	// Get returns a value by the key and updates its recency.
+	Get(key K) (value *T, ok bool)
+	// Peek returns a value by the key without updating its recency.
+	Peek(key K) (value *T, ok bool)
+	// Contains checks if the key is in the storage without updating its recency.
+	Contains(key K) bool
+	// Remove removes the key from the storage. Returns true if the key was present.
+	Remove(key K) (present bool)
+	// Purge removes all keys from the storage.
+	Purge()
+	// Keys returns all keys in the storage, from the oldest to the newest.
+	Keys() []K
+	// Len returns the number of keys in the storage.
+	Len() int
+}
+
+// KeysAppender is an optional extension of Backend that appends its keys to the slice without allocating a new one.
+// It allows KeysInto to avoid allocations when the destination slice has enough capacity.
+type KeysAppender[K comparable] interface {
+	AppendKeys(dst []K) []K
+}
+
+// EvictionNotifier is an optional extension of Backend that reports entries evicted by Add or Resize to free space.
+// Without it, the cache can't report evictions to the logger and the finalizer set by WithValueFinalizer.
+type EvictionNotifier[K comparable, T any] interface {
+	// SetEvictionHandler sets a function called for every entry evicted by Add or Resize. Nil disables notifications.
+	SetEvictionHandler(handler func(key K, value *T))
+}
+
+// Resizer is an optional extension of Backend that allows changing its capacity.
+// It is required by WithoutEviction. The default LRU backend implements it.
+type Resizer interface {
+	// Resize changes the capacity, evicting the oldest entries if needed. Returns the number of evicted entries.
+	Resize(size int) (evicted int)
+}
+
+// WithBackendFactory sets a factory of the session's data storage, replacing the default LRU cache.
+// The factory receives the cacheSize passed to New.
+// K and T must match the types of the cache, otherwise New panics.
+func WithBackendFactory[K comparable, T any](factory func(size int) Backend[K, T]) Option {
+	return func(c *options) {
+		c.backendFactory = factory
+	}
+}
+
+// lruBackend is the default Backend based on the LRU cache. It guards simplelru.LRU with a plain mutex
+// instead of using lru.Cache, whose read-write lock is taken for writing by every Get anyway.
+// Add and SetEvictionHandler must not be called concurrently, ReqCache guarantees it with the write lock.
+type lruBackend[K comparable, T any] struct {
+	mu  sync.Mutex
+	lru *simplelru.LRU[K, *T]
+
+	notify  bool // true during Add and Resize
+	onEvict func(key K, value *T)
+}
+
+// newLRUBackend creates the default Backend.
+func newLRUBackend[K comparable, T any](size int) Backend[K, T] {
+	b := &lruBackend[K, T]{
+		mu:      sync.Mutex{},
+		lru:     nil,
+		notify:  false,
+		onEvict: nil,
+	}
+
+	c, err := simplelru.NewLRU[K, *T](size, b.evicted)
+	if err != nil {
+		panic(fmt.Errorf("failed to create LRU cache: %w", err))
+	}
+	b.lru = c
+
+	return b
+}
+
+// Add adds a value to the cache. Returns true if an eviction occurred.
+func (b *lruBackend[K, T]) Add(key K, value *T) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.notify = true
+	defer func() { b.notify = false }()
+
+	return b.lru.Add(key, value)
+}
+
+// Get returns a value by the key and updates its recency.
+func (b *lruBackend[K, T]) Get(key K) (*T, bool) {
+	b.mu.Lock()
+	value, ok := b.lru.Get(key)
+	b.mu.Unlock()
+
+	return value, ok
+}
+
+// Peek returns a value by the key without updating its recency.
+func (b *lruBackend[K, T]) Peek(key K) (*T, bool) {
+	b.mu.Lock()
+	value, ok := b.lru.Peek(key)
+	b.mu.Unlock()
+
+	return value, ok
+}
+
+// Contains checks if the key is in the cache without updating its recency.
+func (b *lruBackend[K, T]) Contains(key K) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lru.Contains(key)
+}
+
+// Remove removes the key from the cache. Returns true if the key was present.
+func (b *lruBackend[K, T]) Remove(key K) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lru.Remove(key)
+}
+
+// Purge removes all keys from the cache.
+func (b *lruBackend[K, T]) Purge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lru.Purge()
+}
+
+// Keys returns all keys in the cache, from the oldest to the newest.
+func (b *lruBackend[K, T]) Keys() []K {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lru.Keys()
+}
+
+// Len returns the number of keys in the cache.
+func (b *lruBackend[K, T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lru.Len()
+}
+
+// Resize changes the cache size. Returns the number of evicted entries.
+func (b *lruBackend[K, T]) Resize(size int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.notify = true
+	defer func() { b.notify = false }()
+
+	return b.lru.Resize(size)
+}
+
+// SetEvictionHandler sets a function called for every entry evicted by Add or Resize.
+func (b *lruBackend[K, T]) SetEvictionHandler(handler func(key K, value *T)) {
+	b.onEvict = handler
+}
+
+// evicted is called by the LRU cache for every removed entry, including Remove and Purge.
+// It is called under the mutex of the backend.
+func (b *lruBackend[K, T]) evicted(key K, value *T) {
+	if b.notify && b.onEvict != nil {
+		b.onEvict(key, value)
+	}
+}
+
+// collectEvictions calls op and returns the entries evicted from the backend by it to free space.
+// Evictions are collected only if the backend implements EvictionNotifier.
+func collectEvictions[K comparable, T any](b Backend[K, T], op func()) ([]K, []*T) {
+	notifier, ok := b.(EvictionNotifier[K, T])
+	if !ok {
+		op()
+		return nil, nil
+	}
+
+	var (
+		keys   []K
+		values []*T
+	)
+	notifier.SetEvictionHandler(func(k K, v *T) {
+		keys = append(keys, k)
+		values = append(values, v)
+	})
+	op()
+	notifier.SetEvictionHandler(nil)
+
+	return keys, values
+}
@@ -0,0 +1,177 @@
+package reqcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mapBackend is a trivial unbounded Backend implementation for testing purposes.
+type mapBackend[K comparable, T any] struct {
+	mu   sync.Mutex
+	data map[K]*T
+	keys []K
+}
+
+func newMapBackend[K comparable, T any](int) Backend[K, T] {
+	return &mapBackend[K, T]{data: make(map[K]*T)}
+}
+
+func (b *mapBackend[K, T]) Add(key K, value *T) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.data[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.data[key] = value
+
+	return false
+}
+
+func (b *mapBackend[K, T]) Get(key K) (*T, bool) {
+	return b.Peek(key)
+}
+
+func (b *mapBackend[K, T]) Peek(key K) (*T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v, ok := b.data[key]
+
+	return v, ok
+}
+
+func (b *mapBackend[K, T]) Contains(key K) bool {
+	_, ok := b.Peek(key)
+
+	return ok
+}
+
+func (b *mapBackend[K, T]) Remove(key K) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.data[key]; !ok {
+		return false
+	}
+
+	delete(b.data, key)
+	for i, k := range b.keys {
+		if k == key {
+			b.keys = append(b.keys[:i], b.keys[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+func (b *mapBackend[K, T]) Purge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = make(map[K]*T)
+	b.keys = b.keys[:0]
+}
+
+func (b *mapBackend[K, T]) Keys() []K {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]K(nil), b.keys...)
+}
+
+func (b *mapBackend[K, T]) AppendKeys(dst []K) []K {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append(dst, b.keys...)
+}
+
+func (b *mapBackend[K, T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.data)
+}
+
+func TestBackendFactory(t *testing.T) {
+	t.Parallel()
+
+	// The cache size is 1, but the custom backend never evicts
+	cache := New[string, reqCacheTestObject](1, 1,
+		WithBackendFactory(newMapBackend[string, reqCacheTestObject]))
+
+	ctx := NewSession(context.Background())
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{value: 2}))
+
+	v, ok := cache.Get(ctx, "key1")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+	require.True(t, cache.Exists(ctx, "key2"))
+
+	require.True(t, cache.Delete(ctx, "key2"))
+	require.False(t, cache.Exists(ctx, "key2"))
+
+	obj, err := cache.GetOrFetch(ctx, "key3", func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: 3}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, obj.value)
+
+	sum, err := Sum(ctx, cache, func(v *reqCacheTestObject) float64 { return float64(v.value) })
+	require.NoError(t, err)
+	require.InDelta(t, 4.0, sum, 0)
+
+	cache.EndSession(ctx)
+	require.False(t, cache.Exists(ctx, "key1"))
+}
+
+func TestBackendFactoryTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() {
+		New[int, reqCacheTestObject](1, 1, WithBackendFactory(newMapBackend[string, reqCacheTestObject]))
+	})
+}
+
+// Not parallel: AllocsPerRun can't be used in parallel tests.
+func TestReqCache_KeysInto(t *testing.T) {
+	cache := New[string, reqCacheTestObject](1, 10,
+		WithBackendFactory(newMapBackend[string, reqCacheTestObject]))
+
+	_, err := cache.KeysInto(context.Background(), nil)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{}))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{}))
+
+	buf := make([]string, 0, 10)
+	keys, err = cache.KeysInto(ctx, buf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"key1", "key2"}, keys)
+
+	require.NoError(t, cache.Put(ctx, "key3", &reqCacheTestObject{}))
+	keys, err = cache.KeysInto(ctx, keys[:0])
+	require.NoError(t, err)
+	require.Equal(t, []string{"key1", "key2", "key3"}, keys)
+
+	// No allocations when the buffer is reused
+	allocs := testing.AllocsPerRun(100, func() {
+		keys, _ = cache.KeysInto(ctx, keys[:0])
+	})
+	require.Zero(t, allocs)
+	require.Len(t, keys, 3)
+}
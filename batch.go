@@ -0,0 +1,344 @@
+package reqcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithBatchDeadline limits the total time of GetOrFetchMany and GetOrFetchEachBestEffort.
+// The fetchers get a context with the deadline. When it expires, the methods return without waiting for the
+// fetchers: GetOrFetchMany returns the cached data and the deadline error, GetOrFetchEachBestEffort returns
+// the data fetched so far and the deadline errors of the remaining keys.
+// The results of the fetchers completing after the deadline are discarded.
+func WithBatchDeadline(d time.Duration) Option {
+	return func(c *options) {
+		c.batchDeadline = d
+	}
+}
+
+// GetOrFetchMany returns the data for the keys from the cache and fetches the missing keys with one fetcher call.
+// The fetched data is cached and added to the result. Keys absent from the fetcher result are absent from the result.
+// The fetcher result entries for keys that weren't requested as missing are ignored,
+// or if WithStrictFetcherResults is set, ErrUnexpectedFetcherKey is returned and nothing is cached.
+// With WithBatchDeadline, if the fetcher doesn't complete before the deadline, the cached data is returned
+// together with the context error.
+func (m *ReqCache[K, T]) GetOrFetchMany(ctx context.Context, keys []K,
+	fetcher func(ctx context.Context, missing []K) (map[K]*T, error),
+) (map[K]*T, error) {
+	if err := m.checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	res := make(map[K]*T, len(keys))
+	missing := make(map[K]struct{})
+	var missingKeys []K
+
+	for _, k := range keys {
+		if _, ok := missing[k]; ok {
+			continue
+		}
+
+		if v, ok := m.Get(ctx, k); ok {
+			res[k] = v
+			continue
+		}
+
+		missing[k] = struct{}{}
+		missingKeys = append(missingKeys, k)
+	}
+
+	if len(missingKeys) == 0 {
+		return res, nil
+	}
+
+	defer m.beginWrite(ctx)()
+
+	if m.op.efficiencyTracking {
+		effectiveKeys := make([]K, len(missingKeys))
+		for i, k := range missingKeys {
+			effectiveKeys[i] = m.effectiveKey(ctx, k)
+		}
+		m.trackKeys(ctx, true, effectiveKeys...)
+	}
+
+	fetched, err := m.callBatchFetcher(ctx, missingKeys, fetcher)
+	if err != nil {
+		if m.op.batchDeadline > 0 && errors.Is(err, context.DeadlineExceeded) {
+			return res, err
+		}
+
+		return nil, err
+	}
+
+	if m.op.strictFetcherResults {
+		for k := range fetched {
+			if _, ok := missing[k]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnexpectedFetcherKey, keyString(k))
+			}
+		}
+	}
+
+	for k, v := range fetched {
+		if _, ok := missing[k]; !ok {
+			continue
+		}
+
+		if err = m.Put(ctx, k, v); err != nil {
+			return nil, err
+		}
+		res[k] = v
+	}
+
+	return res, nil
+}
+
+// GetOrFetchEachBestEffort works like GetOrFetch for each of the keys, calling the fetcher for the missing keys
+// concurrently. A failed key doesn't stop fetching the others: the result contains the data for all successful keys,
+// the error joins the errors of all failed keys (each error is wrapped with its key) and can be checked with errors.Is.
+// With WithBatchDeadline, the keys not fetched before the deadline fail with the context error.
+func (m *ReqCache[K, T]) GetOrFetchEachBestEffort(ctx context.Context, keys []K,
+	fetcher func(ctx context.Context, key K) (*T, error),
+) (map[K]*T, error) {
+	if err := m.checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	batchCtx, cancel := m.batchContext(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		res     = make(map[K]*T, len(keys))
+		errs    []error
+		pending = make(map[K]struct{}, len(keys))
+		expired bool // the deadline has expired, the results are not collected anymore
+	)
+
+	for _, k := range keys {
+		pending[k] = struct{}{}
+	}
+
+	for _, k := range keys {
+		wg.Add(1)
+
+		go func(k K) {
+			defer wg.Done()
+
+			obj, err := m.GetOrFetch(batchCtx, k, func(ctx context.Context) (*T, error) {
+				obj, err := fetcher(ctx, k)
+				if err == nil && m.op.batchDeadline > 0 {
+					// don't cache the results completed after the deadline, the session may have ended
+					err = ctx.Err()
+				}
+
+				return obj, err
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if expired {
+				return
+			}
+			delete(pending, k)
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("key %s: %w", keyString(k), err))
+				return
+			}
+
+			res[k] = obj
+		}(k)
+	}
+
+	completed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(completed)
+	}()
+
+	var deadline <-chan struct{} // nil without WithBatchDeadline, so only the completion is awaited
+	if m.op.batchDeadline > 0 {
+		deadline = batchCtx.Done()
+	}
+
+	select {
+	case <-completed:
+	case <-deadline:
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expired = true
+	for k := range pending {
+		errs = append(errs, fmt.Errorf("key %s: %w", keyString(k), batchCtx.Err()))
+	}
+
+	return res, joinErrors(errs...)
+}
+
+// batchContext returns the context for the fetchers of a batch, limited by WithBatchDeadline if it is set.
+func (m *ReqCache[K, T]) batchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.op.batchDeadline <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, m.op.batchDeadline)
+}
+
+// callBatchFetcher calls the fetcher of GetOrFetchMany. With WithBatchDeadline, it returns the context error
+// if the fetcher doesn't complete before the deadline, leaving the fetcher running in the background.
+func (m *ReqCache[K, T]) callBatchFetcher(ctx context.Context, keys []K,
+	fetcher func(ctx context.Context, missing []K) (map[K]*T, error),
+) (map[K]*T, error) {
+	if m.op.batchDeadline <= 0 {
+		return fetcher(ctx, keys)
+	}
+
+	batchCtx, cancel := m.batchContext(ctx)
+	defer cancel()
+
+	type result struct {
+		data map[K]*T
+		err  error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		data, err := fetcher(batchCtx, keys)
+		done <- result{data: data, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-batchCtx.Done():
+		return nil, batchCtx.Err()
+	}
+}
+
+// ExistsAll returns the keys that aren't in the cache, preserving their order. Nil means all keys are present.
+// All keys are checked under one lock, without updating their recency and the hit/miss counters.
+func (m *ReqCache[K, T]) ExistsAll(ctx context.Context, keys []K) ([]K, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		return missingKeys(keys, func(k K) bool {
+			_, found := snapshot.index[m.effectiveKey(ctx, k)]
+			return found
+		}), nil
+	}
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	d, ok := shard.backend(requestKey)
+	if !ok {
+		return missingKeys(keys, func(K) bool { return false }), nil
+	}
+
+	return missingKeys(keys, func(k K) bool { return d.Contains(m.effectiveKey(ctx, k)) }), nil
+}
+
+// missingKeys returns the keys for which exists returns false.
+func missingKeys[K comparable](keys []K, exists func(K) bool) []K {
+	var missing []K
+	for _, k := range keys {
+		if !exists(k) {
+			missing = append(missing, k)
+		}
+	}
+
+	return missing
+}
+
+// GetMany looks up the keys taking the lock once and returns the found data with the missing keys
+// in the order of keys, e.g. to fetch them with one downstream call. Every key is counted in the hit/miss statistics
+// and updates the recency of its data like Get.
+func (m *ReqCache[K, T]) GetMany(ctx context.Context, keys []K) (map[K]*T, []K, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make(map[K]*T, len(keys))
+	missing := m.getMany(ctx, requestKey, keys, found)
+
+	return found, missing, nil
+}
+
+// GetManyInto works like GetMany, but puts the found data into dst, which is cleared first, so the map can be reused
+// across calls to avoid allocations. Missing keys are not added to dst.
+func (m *ReqCache[K, T]) GetManyInto(ctx context.Context, keys []K, dst map[K]*T) error {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	for k := range dst {
+		delete(dst, k)
+	}
+
+	m.getMany(ctx, requestKey, keys, dst)
+
+	return nil
+}
+
+// getMany puts the cached data of the keys into dst and returns the missing keys.
+func (m *ReqCache[K, T]) getMany(ctx context.Context, requestKey uint64, keys []K, dst map[K]*T) []K {
+	m.checkCache()
+
+	lookup := func(d Backend[K, T]) {
+		for _, k := range keys {
+			if obj, ok := d.Get(m.effectiveKey(ctx, k)); ok {
+				dst[k] = obj
+			}
+		}
+	}
+
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		for _, k := range keys {
+			if obj, found := snapshot.index[m.effectiveKey(ctx, k)]; found {
+				dst[k] = obj
+			}
+		}
+	} else if e, ok, lockFree := m.loadEntry(requestKey); lockFree {
+		if ok {
+			lookup(e.backend)
+		}
+	} else {
+		shard := m.dataShard(requestKey)
+		shard.mu.RLock()
+		if d, ok := shard.backend(requestKey); ok {
+			lookup(d)
+		}
+		shard.mu.RUnlock()
+	}
+
+	var missing []K
+	for _, k := range keys {
+		_, found := dst[k]
+		if found && m.expired(ctx, k) {
+			delete(dst, k)
+			found = false
+		}
+		m.recordCacheHit(ctx, k, found)
+
+		if !found {
+			missing = append(missing, k)
+		}
+	}
+
+	return missing
+}
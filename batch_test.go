@@ -0,0 +1,313 @@
+package reqcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_GetOrFetchEachBestEffort(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+
+	errTwo := errors.New("two failed")
+	errFour := errors.New("four failed")
+
+	var calls int32
+	fetcher := func(_ context.Context, key int) (*reqCacheTestObject, error) {
+		atomic.AddInt32(&calls, 1)
+
+		switch key {
+		case 2:
+			return nil, errTwo
+		case 4:
+			return nil, errFour
+		default:
+			return &reqCacheTestObject{value: key}, nil
+		}
+	}
+
+	res, err := cache.GetOrFetchEachBestEffort(ctx, []int{1, 2, 3, 4, 5}, fetcher)
+	require.ErrorIs(t, err, errTwo)
+	require.ErrorIs(t, err, errFour)
+	require.Contains(t, err.Error(), "key 2: two failed")
+	require.Contains(t, err.Error(), "key 4: four failed")
+	require.EqualValues(t, 4, atomic.LoadInt32(&calls), "Cached key must not be fetched")
+
+	require.Len(t, res, 3)
+	for _, key := range []int{1, 3, 5} {
+		require.Equal(t, key, res[key].value)
+		require.True(t, cache.Exists(ctx, key))
+	}
+	require.False(t, cache.Exists(ctx, 2))
+	require.False(t, cache.Exists(ctx, 4))
+
+	// No error if all keys succeed
+	res, err = cache.GetOrFetchEachBestEffort(ctx, []int{1, 3}, fetcher)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+}
+
+func TestReqCache_GetOrFetchMany(t *testing.T) {
+	t.Parallel()
+
+	// overReturning fetches the requested keys and a key that wasn't requested
+	var requested []int
+	overReturning := func(_ context.Context, missing []int) (map[int]*reqCacheTestObject, error) {
+		requested = missing
+		res := map[int]*reqCacheTestObject{100: {value: 100}}
+		for _, k := range missing {
+			if k != 4 { // not found in the source
+				res[k] = &reqCacheTestObject{value: k}
+			}
+		}
+		return res, nil
+	}
+
+	t.Run("lenient", func(t *testing.T) {
+		cache := New[int, reqCacheTestObject](0, 10)
+
+		ctx := NewSession(context.Background())
+		defer cache.EndSession(ctx)
+
+		require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+
+		res, err := cache.GetOrFetchMany(ctx, []int{1, 2, 3, 2, 4}, overReturning)
+		require.NoError(t, err)
+		require.Equal(t, []int{2, 3, 4}, requested)
+		require.Len(t, res, 3)
+		for _, k := range []int{1, 2, 3} {
+			require.Equal(t, k, res[k].value)
+			require.True(t, cache.Exists(ctx, k))
+		}
+		require.False(t, cache.Exists(ctx, 100), "Unexpected key must not be cached")
+
+		// Everything is cached, the fetcher is not called
+		res, err = cache.GetOrFetchMany(ctx, []int{1, 2}, func(context.Context, []int) (map[int]*reqCacheTestObject, error) {
+			return nil, errors.New("unexpected fetch")
+		})
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		cache := New[int, reqCacheTestObject](0, 10, WithStrictFetcherResults())
+
+		ctx := NewSession(context.Background())
+		defer cache.EndSession(ctx)
+
+		_, err := cache.GetOrFetchMany(ctx, []int{1, 2}, overReturning)
+		require.ErrorIs(t, err, ErrUnexpectedFetcherKey)
+		require.Contains(t, err.Error(), "100")
+		require.False(t, cache.Exists(ctx, 1), "Nothing must be cached")
+		require.False(t, cache.Exists(ctx, 100))
+	})
+}
+
+func TestReqCache_ExistsAll(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[int, reqCacheTestObject](0, 10, WithLogger("test", logger))
+
+	_, err := cache.ExistsAll(context.Background(), []int{1})
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// No data in the session yet
+	missing, err := cache.ExistsAll(ctx, []int{1, 2})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, missing)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+
+	missing, err = cache.ExistsAll(ctx, []int{1, 2, 3})
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	missing, err = cache.ExistsAll(ctx, []int{4, 1, 5, 3})
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 5}, missing)
+
+	missing, err = cache.ExistsAll(ctx, []int{4, 5})
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 5}, missing)
+
+	// Recency and counters are not affected
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, keys)
+	require.Zero(t, logger.cacheHit)
+	require.Zero(t, logger.cacheMiss)
+}
+
+func TestReqCache_BatchDeadline(t *testing.T) {
+	t.Parallel()
+
+	const deadline = 50 * time.Millisecond
+
+	// release unblocks the slow fetchers ignoring the context
+	release := make(chan struct{})
+	defer close(release)
+
+	t.Run("each", func(t *testing.T) {
+		cache := New[int, reqCacheTestObject](0, 10, WithBatchDeadline(deadline))
+
+		ctx := NewSession(context.Background())
+		defer cache.EndSession(ctx)
+
+		start := time.Now()
+		res, err := cache.GetOrFetchEachBestEffort(ctx, []int{1, 2, 3},
+			func(_ context.Context, key int) (*reqCacheTestObject, error) {
+				if key == 2 {
+					<-release
+				}
+				return &reqCacheTestObject{value: key}, nil
+			})
+		require.Less(t, time.Since(start), time.Second, "The deadline must not wait for slow fetchers")
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), "key 2")
+		require.Len(t, res, 2)
+		require.Equal(t, 1, res[1].value)
+		require.Equal(t, 3, res[3].value)
+	})
+
+	t.Run("late fetchers", func(t *testing.T) {
+		// the leak threshold makes CheckInvariants report the sessions registered after their end,
+		// the efficiency tracking makes the lookups track the session
+		cache := New[int, reqCacheTestObject](0, 10,
+			WithBatchDeadline(deadline), WithLeakThreshold(100), WithEfficiencyTracking())
+
+		ctx := NewSession(context.Background())
+		_, err := cache.GetOrFetchEachBestEffort(ctx, []int{1},
+			func(context.Context, int) (*reqCacheTestObject, error) {
+				<-release
+				return &reqCacheTestObject{value: 1}, nil
+			})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.NoError(t, cache.EndSession(ctx))
+
+		// A goroutine of the batch scheduled after the end of the session, with the batch context already done,
+		// doesn't register the session again
+		batchCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = cache.GetOrFetch(batchCtx, 2, func(context.Context) (*reqCacheTestObject, error) {
+			return &reqCacheTestObject{value: 2}, nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, cache.SessionsSnapshot())
+		require.NoError(t, cache.CheckInvariants())
+	})
+
+	t.Run("many", func(t *testing.T) {
+		cache := New[int, reqCacheTestObject](0, 10, WithBatchDeadline(deadline))
+
+		ctx := NewSession(context.Background())
+		defer cache.EndSession(ctx)
+
+		require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+
+		res, err := cache.GetOrFetchMany(ctx, []int{1, 2},
+			func(context.Context, []int) (map[int]*reqCacheTestObject, error) {
+				<-release
+				return nil, nil
+			})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Len(t, res, 1, "Cached data is returned")
+		require.Equal(t, 1, res[1].value)
+
+		// A fetcher completing in time works as usual
+		res, err = cache.GetOrFetchMany(ctx, []int{1, 2},
+			func(_ context.Context, missing []int) (map[int]*reqCacheTestObject, error) {
+				return map[int]*reqCacheTestObject{2: {value: 2}}, nil
+			})
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+	})
+}
+
+func TestReqCache_GetMany(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[int, reqCacheTestObject](0, 3, WithLogger("test", logger))
+
+	_, _, err := cache.GetMany(context.Background(), []int{1})
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// No data in the session yet
+	found, missing, err := cache.GetMany(ctx, []int{2, 1})
+	require.NoError(t, err)
+	require.Empty(t, found)
+	require.Equal(t, []int{2, 1}, missing)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+
+	found, missing, err = cache.GetMany(ctx, []int{5, 1, 4, 3})
+	require.NoError(t, err)
+	require.Equal(t, []int{5, 4}, missing)
+	require.Len(t, found, 2)
+	require.Equal(t, 1, found[1].value)
+	require.Equal(t, 3, found[3].value)
+
+	require.Equal(t, 2, logger.cacheHit)
+	require.Equal(t, 4, logger.cacheMiss)
+
+	// The found keys became the newest, so 2 is evicted
+	require.NoError(t, cache.Put(ctx, 4, &reqCacheTestObject{value: 4}))
+	require.False(t, cache.Exists(ctx, 2))
+	require.True(t, cache.Exists(ctx, 1))
+}
+
+func TestReqCache_GetManyInto(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[int, reqCacheTestObject](0, 10, WithLogger("test", logger))
+
+	dst := map[int]*reqCacheTestObject{100: {value: 100}}
+	require.ErrorIs(t, cache.GetManyInto(context.Background(), []int{1}, dst), ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+
+	require.NoError(t, cache.GetManyInto(ctx, []int{1, 2, 4}, dst))
+	require.Len(t, dst, 2, "The map must be cleared")
+	require.Equal(t, 1, dst[1].value)
+	require.Equal(t, 2, dst[2].value)
+
+	// The same map is reused
+	require.NoError(t, cache.GetManyInto(ctx, []int{3, 5}, dst))
+	require.Len(t, dst, 1)
+	require.Equal(t, 3, dst[3].value)
+
+	require.NoError(t, cache.GetManyInto(ctx, nil, dst))
+	require.Empty(t, dst)
+
+	require.Equal(t, 3, logger.cacheHit)
+	require.Equal(t, 2, logger.cacheMiss)
+}
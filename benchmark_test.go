@@ -2,6 +2,9 @@ package reqcache
 
 import (
 	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
 	"testing"
 )
 
@@ -59,3 +62,263 @@ func BenchmarkWithBatchAllocation(b *testing.B) {
 	_ = obj
 	_ = ctx
 }
+
+// LargeBenchObject simulates a large object.
+type LargeBenchObject struct {
+	Data [4096]byte
+}
+
+// Benchmark reusing a large object pool when only a few objects are used per request.
+// Only the used objects are zeroed on reuse, so the cost doesn't depend on the pool size.
+func BenchmarkObjectPoolReuseLargeObjects(b *testing.B) {
+	const poolSize = 1000
+
+	for _, used := range []int{4, poolSize} {
+		b.Run(fmt.Sprintf("used=%d", used), func(b *testing.B) {
+			cache := New[string, LargeBenchObject](poolSize, 0)
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				ctx := NewSession(context.Background())
+				for i := 0; i < used; i++ {
+					cache.NewObject(ctx)
+				}
+				cache.EndSession(ctx)
+			}
+		})
+	}
+}
+
+// Benchmark of reusing an object pool of 10000 objects when only 10 are used per request,
+// zeroing the used prefix versus the whole array as before the watermark was tracked.
+func BenchmarkObjectPoolReuseZeroing(b *testing.B) {
+	const (
+		poolSize = 10000
+		used     = 10
+	)
+
+	for _, whole := range []bool{false, true} {
+		b.Run(fmt.Sprintf("whole=%v", whole), func(b *testing.B) {
+			ctx := context.Background()
+			pool := newObjectPool[BenchObject](poolSize, newLoggerHolder("bench", nil))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < used; i++ {
+					pool.get(ctx)
+				}
+				if whole {
+					pool.index = poolSize // makes reset zero every object
+				}
+				pool.reset(poolSize)
+			}
+		})
+	}
+}
+
+// Benchmark of the cache lookups without a logger.
+func BenchmarkGet(b *testing.B) {
+	cache := New[int, BenchObject](0, 100)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	if err := cache.Put(ctx, 1, &BenchObject{}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("hit", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cache.Get(ctx, 1)
+		}
+	})
+
+	b.Run("miss", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cache.Get(ctx, 2)
+		}
+	})
+
+	b.Run("exists", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cache.Exists(ctx, 1)
+		}
+	})
+}
+
+// Benchmark of concurrent cache hits of many sessions, with and without the lock-free session map.
+func BenchmarkGetParallel(b *testing.B) {
+	for _, lockFree := range []bool{false, true} {
+		b.Run(fmt.Sprintf("lockFree=%v", lockFree), func(b *testing.B) {
+			var opts []Option
+			if lockFree {
+				opts = append(opts, WithLockFreeSessionMap())
+			}
+			cache := New[int, BenchObject](0, 100, opts...)
+
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				ctx := NewSession(context.Background())
+				defer cache.EndSession(ctx)
+
+				if err := cache.Put(ctx, 1, &BenchObject{}); err != nil {
+					panic(err)
+				}
+
+				for pb.Next() {
+					cache.Get(ctx, 1)
+				}
+			})
+		})
+	}
+}
+
+// Benchmark of concurrent ValueCache updates of distinct keys within one session.
+func BenchmarkValueCacheUpdateParallel(b *testing.B) {
+	const keys = 64
+
+	cache := NewValueCache[int, BenchObject](keys, keys)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for i := 0; i < keys; i++ {
+		if err := cache.Put(ctx, i, BenchObject{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var next int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		key := int(atomic.AddInt64(&next, 1) % keys)
+		for pb.Next() {
+			if _, err := cache.Update(ctx, key, func(v *BenchObject) { v.Data[0]++ }); err != nil {
+				panic(err)
+			}
+		}
+	})
+}
+
+// Benchmark of high session churn, with and without batched pool returns.
+func BenchmarkSessionChurn(b *testing.B) {
+	for _, batched := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batched=%v", batched), func(b *testing.B) {
+			var opts []Option
+			if batched {
+				opts = append(opts, WithBatchedPoolReturns())
+			}
+			cache := New[int, BenchObject](10, 10, opts...)
+
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ctx := NewSession(context.Background())
+					cache.NewObject(ctx)
+					if err := cache.Put(ctx, 1, &BenchObject{}); err != nil {
+						panic(err)
+					}
+					cache.EndSession(ctx)
+				}
+			})
+		})
+	}
+}
+
+// Benchmark of a short session: one object, one entry and one lookup.
+func BenchmarkSessionCycle(b *testing.B) {
+	cache := New[int, BenchObject](10, 10)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ctx := NewSession(context.Background())
+		if err := cache.Put(ctx, 1, cache.NewObject(ctx)); err != nil {
+			b.Fatal(err)
+		}
+		cache.Get(ctx, 1)
+		cache.EndSession(ctx)
+	}
+}
+
+// Benchmark of sessions that regularly exceed the preallocated array, with and without the overflow pool.
+func BenchmarkOverflowHeavy(b *testing.B) {
+	const (
+		poolSize = 10
+		used     = 100
+	)
+
+	for _, overflowPool := range []bool{false, true} {
+		b.Run(fmt.Sprintf("overflowPool=%v", overflowPool), func(b *testing.B) {
+			var opts []Option
+			if overflowPool {
+				opts = append(opts, WithOverflowPool())
+			}
+			cache := New[string, BenchObject](poolSize, 0, opts...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				ctx := NewSession(context.Background())
+				for i := 0; i < used; i++ {
+					cache.NewObject(ctx)
+				}
+				cache.EndSession(ctx)
+			}
+		})
+	}
+}
+
+// Benchmark of many concurrent sessions storing and reading data, with one and with the default number of data shards.
+func BenchmarkDataShards(b *testing.B) {
+	const goroutines = 256
+
+	for _, shards := range []int{1, defaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cache := New[int, BenchObject](0, 100, withShards(shards))
+
+			b.ReportAllocs()
+			// RunParallel starts parallelism*GOMAXPROCS goroutines
+			b.SetParallelism((goroutines + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+			b.RunParallel(func(pb *testing.PB) {
+				ctx := NewSession(context.Background())
+				defer cache.EndSession(ctx)
+
+				obj := &BenchObject{}
+				for i := 0; pb.Next(); i++ {
+					if err := cache.Put(ctx, i%100, obj); err != nil {
+						panic(err)
+					}
+					cache.Get(ctx, i%100)
+				}
+			})
+		})
+	}
+}
+
+// Benchmark of many concurrent sessions creating objects, with one and with the default number of object shards.
+func BenchmarkObjectShards(b *testing.B) {
+	const goroutines = 256
+
+	for _, shards := range []int{1, defaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cache := New[int, BenchObject](100, 0, withShards(shards))
+
+			b.ReportAllocs()
+			// RunParallel starts parallelism*GOMAXPROCS goroutines
+			b.SetParallelism((goroutines + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ctx := NewSession(context.Background())
+					for i := 0; i < 10; i++ {
+						cache.NewObject(ctx)
+					}
+					cache.EndSession(ctx)
+				}
+			})
+		})
+	}
+}
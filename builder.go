@@ -0,0 +1,87 @@
+package reqcache
+
+import "fmt"
+
+// CacheBuilder configures a ReqCache with named methods. It is created by Builder.
+type CacheBuilder[K comparable, T any] struct {
+	objSize   int
+	cacheSize int
+	opts      []Option
+}
+
+// Builder returns a builder of a ReqCache, an alternative to New where the sizes can't be swapped by mistake:
+//
+//	cache, err := reqcache.Builder[string, User]().ObjSize(100).CacheSize(1000).Logger("users", logger).Build()
+//
+// Both sizes are 0 by default.
+func Builder[K comparable, T any]() *CacheBuilder[K, T] {
+	return &CacheBuilder[K, T]{
+		objSize:   0,
+		cacheSize: 0,
+		opts:      nil,
+	}
+}
+
+// ObjSize sets the size of the array of objects of type T, preallocating memory for them. See New.
+func (b *CacheBuilder[K, T]) ObjSize(n int) *CacheBuilder[K, T] {
+	b.objSize = n
+	return b
+}
+
+// CacheSize sets the size of the cache in a single request. See New.
+func (b *CacheBuilder[K, T]) CacheSize(n int) *CacheBuilder[K, T] {
+	b.cacheSize = n
+	return b
+}
+
+// Logger sets the logger like WithLogger.
+func (b *CacheBuilder[K, T]) Logger(name string, logger ILogger) *CacheBuilder[K, T] {
+	b.opts = append(b.opts, WithLogger(name, logger))
+	return b
+}
+
+// Options adds options.
+func (b *CacheBuilder[K, T]) Options(opts ...Option) *CacheBuilder[K, T] {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Build creates the cache. Unlike New, it returns an error wrapping ErrInvalidConfig instead of panicking
+// if the configuration is invalid: a size is negative, both sizes are 0 without WithUnbounded
+// or an option doesn't match the cache types.
+func (b *CacheBuilder[K, T]) Build() (*ReqCache[K, T], error) {
+	if b.objSize < 0 || b.cacheSize < 0 {
+		return nil, fmt.Errorf("%w: negative size", ErrInvalidConfig)
+	}
+
+	var op options
+	for _, opt := range b.opts {
+		opt(&op)
+	}
+
+	if b.objSize == 0 && b.cacheSize == 0 && !op.unbounded {
+		return nil, fmt.Errorf("%w: both sizes are 0", ErrInvalidConfig)
+	}
+
+	return newChecked[K, T](b.objSize, b.cacheSize, b.opts...)
+}
+
+// newChecked works like New, but returns an error wrapping ErrInvalidConfig instead of panicking.
+func newChecked[K comparable, T any](objSize, cacheSize int, opts ...Option) (*ReqCache[K, T], error) {
+	var (
+		m   *ReqCache[K, T]
+		err error
+	)
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrInvalidConfig, r)
+			}
+		}()
+
+		m = New[K, T](objSize, cacheSize, opts...)
+	}()
+
+	return m, err
+}
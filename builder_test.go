@@ -0,0 +1,65 @@
+package reqcache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache, err := Builder[string, reqCacheTestObject]().
+		CacheSize(10).
+		ObjSize(2).
+		Logger("test", logger).
+		Options(WithRejectNil()).
+		Build()
+	require.NoError(t, err)
+
+	// The sizes are not swapped
+	require.Equal(t, 2, cache.objSize)
+	require.Equal(t, 10, cache.cacheSize)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.ErrorIs(t, cache.Put(ctx, "nil", nil), ErrNilValue)
+	require.NoError(t, cache.Put(ctx, "key", cache.NewObject(ctx)))
+	_, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, logger.cacheHit)
+	require.Equal(t, "test", logger.name)
+}
+
+func TestBuilderHelper(t *testing.T) {
+	t.Parallel()
+
+	// The builder can be passed to a helper applying the common settings
+	withDefaults := func(b *CacheBuilder[string, reqCacheTestObject]) *CacheBuilder[string, reqCacheTestObject] {
+		return b.CacheSize(10).Options(WithRejectNil())
+	}
+
+	cache, err := withDefaults(Builder[string, reqCacheTestObject]()).ObjSize(2).Build()
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.objSize)
+	require.Equal(t, 10, cache.cacheSize)
+}
+
+func TestBuilderErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := Builder[string, reqCacheTestObject]().ObjSize(-1).CacheSize(10).Build()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	_, err = Builder[string, reqCacheTestObject]().Build()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	// A panic of New is returned as an error
+	_, err = Builder[int, reqCacheTestObject]().CacheSize(10).Options(WithFetchKeyNormalizer(strings.ToLower)).Build()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.Contains(t, err.Error(), "fetch key normalizer")
+}
@@ -1,39 +1,50 @@
 package reqcache
 
 import (
-	"fmt"
 	"sync"
-
-	lru "github.com/hashicorp/golang-lru/v2"
+	"sync/atomic"
 )
 
 // cachePool is a wrapper around sync.Pool.
 type cachePool[K comparable, T any] struct {
+	allocs uint64 // number of storages created because the pool was empty, accessed atomically
+
 	pool *sync.Pool
+	size int
 }
 
 // newPoolWrapper creates a new poolWrapper.
-func newPoolWrapper[K comparable, T any](size int) *cachePool[K, T] {
-	return &cachePool[K, T]{
-		pool: &sync.Pool{
-			New: func() any {
-				c, err := lru.New[K, *T](size)
-				if err != nil {
-					panic(fmt.Errorf("failed to create poolWrapper: %w", err))
-				}
-				return c
-			},
+func newPoolWrapper[K comparable, T any](size int, factory func(size int) Backend[K, T]) *cachePool[K, T] {
+	w := &cachePool[K, T]{
+		allocs: 0,
+		pool:   nil,
+		size:   size,
+	}
+	w.pool = &sync.Pool{
+		New: func() any {
+			atomic.AddUint64(&w.allocs, 1)
+			return &sessionData[K, T]{
+				state:       nil,
+				backend:     factory(size),
+				expirations: nil,
+			}
 		},
 	}
+
+	return w
 }
 
-// Get returns an object from the pool.
-func (w *cachePool[K, T]) Get() *lru.Cache[K, *T] {
-	return w.pool.Get().(*lru.Cache[K, *T])
+// Get returns a session entry with an empty storage from the pool.
+func (w *cachePool[K, T]) Get() *sessionData[K, T] {
+	return w.pool.Get().(*sessionData[K, T])
 }
 
-// Put puts an object in the pool.
-func (w *cachePool[K, T]) Put(v *lru.Cache[K, *T]) {
-	v.Purge()
-	w.pool.Put(v)
+// Put resets the session entry and puts it in the pool.
+func (w *cachePool[K, T]) Put(e *sessionData[K, T]) {
+	e.backend.Purge()
+	if r, ok := e.backend.(Resizer); ok {
+		// restore the capacity changed during the session
+		r.Resize(w.size)
+	}
+	w.pool.Put(e)
 }
@@ -18,10 +18,11 @@ func TestCachePool(t *testing.T) {
 	values := []*cachePoolTestObject{{value: 1}, {value: 2}, {value: 3}}
 
 	// Create a new pool wrapper with cache size 2
-	pool := newPoolWrapper[int, cachePoolTestObject](2)
+	pool := newPoolWrapper[int, cachePoolTestObject](2, newLRUBackend[int, cachePoolTestObject])
 
 	// Get a cache instance from pool
-	cache := pool.Get()
+	entry := pool.Get()
+	cache := entry.backend
 
 	// Ensure cache is empty initially
 	for _, key := range keys {
@@ -46,10 +47,10 @@ func TestCachePool(t *testing.T) {
 	}
 
 	// Put the cache back into the pool
-	pool.Put(cache)
+	pool.Put(entry)
 
 	// Get a new cache instance from pool and verify it is empty (since we called Purge)
-	newCache := pool.Get()
+	newCache := pool.Get().backend
 	for _, key := range keys {
 		_, ok = newCache.Get(key)
 		require.False(t, ok, "expected cache to be empty after purge")
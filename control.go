@@ -0,0 +1,179 @@
+package reqcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// CacheControl is the freshness of the data returned by the fetcher of GetOrFetchControlled,
+// e.g. taken from the Cache-Control header of the upstream response.
+type CacheControl struct {
+	// TTL is the time after which Get treats the data as a miss and deletes it. Zero means no expiration.
+	TTL time.Duration
+	// NoStore means the data must not be cached.
+	NoStore bool
+}
+
+// WithTTL makes the entries expire d after they were stored: Get, Exists and Peek treat them as misses
+// and delete them. There is no background sweeper, so the expired entries that aren't accessed still occupy
+// the session's storage until they are evicted or the session ends, and other methods still see them.
+// Storing the data for the key again resets its expiration. GetOrFetchControlled overrides the TTL
+// by a positive CacheControl.TTL. The time is taken from WithClock. By default, entries don't expire.
+func WithTTL(d time.Duration) Option {
+	return func(c *options) {
+		c.ttl = d
+	}
+}
+
+// GetOrFetchControlled works like GetOrFetch, but the fetcher also returns the CacheControl of the data:
+// the data isn't cached if NoStore is set, and expires after TTL otherwise. The expired data is removed lazily
+// by Get, Exists, Peek and the methods using them, other methods still see it. Storing the data for the key
+// by Put or another method resets its expiration to the one set by WithTTL. Like with GetOrFetch, concurrent calls
+// of the session for the same key share one fetcher call and its CacheControl, a panic of the fetcher is returned
+// as ErrFetcherPanicked, and a canceled context prevents caching. The time is taken from WithClock.
+func (m *ReqCache[K, T]) GetOrFetchControlled(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, CacheControl, error),
+) (*T, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if v, ok := m.Get(ctx, dataKey); ok {
+		return v, nil
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	defer m.beginWrite(ctx)()
+
+	obj, control, err := m.fetchSharedControlled(ctx, dataKey, fetcher)
+	if err != nil || control.NoStore {
+		return obj, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.Put(ctx, dataKey, obj); err != nil {
+		return nil, err
+	}
+
+	if control.TTL > 0 {
+		m.expireAt(requestKey, m.effectiveKey(ctx, dataKey), m.now().Add(control.TTL))
+	}
+
+	return obj, nil
+}
+
+// expired reports whether the entry found by Get has expired according to its TTL or WithIdleTimeout,
+// deleting it in this case. The reads of a snapshot taken by WithReadSnapshot only report the expiration,
+// the entry is deleted by the next read of the live session.
+func (m *ReqCache[K, T]) expired(ctx context.Context, dataKey K) bool {
+	if m.ttlExpired(ctx, dataKey) {
+		return true
+	}
+
+	return m.op.idleTimeout > 0 && m.expireIdle(ctx, dataKey)
+}
+
+// ttlExpired works like expired, but ignores WithIdleTimeout. It is used by Exists and Peek.
+func (m *ReqCache[K, T]) ttlExpired(ctx context.Context, dataKey K) bool {
+	if atomic.LoadInt32(&m.expiringSessions) == 0 {
+		return false
+	}
+
+	requestKey := fromContext(ctx)
+	key := m.effectiveKey(ctx, dataKey)
+
+	var (
+		expires time.Time
+		ok      bool
+	)
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	if e, found := shard.data[requestKey]; found {
+		expires, ok = e.expirations[key]
+	}
+	shard.mu.RUnlock()
+
+	if !ok || m.now().Before(expires) {
+		return false
+	}
+
+	if _, snapshot := m.readSnapshot(ctx); !snapshot {
+		m.delete(ctx, dataKey) // forgets the expiration time as well
+	}
+
+	return true
+}
+
+// ttlPassed reports whether the expiration time of the key in the session's entry has passed.
+// Must be called under the lock of the session's data shard.
+func (m *ReqCache[K, T]) ttlPassed(e *sessionData[K, T], key K) bool {
+	if len(e.expirations) == 0 {
+		return false
+	}
+
+	expires, ok := e.expirations[key]
+
+	return ok && !m.now().Before(expires)
+}
+
+// expireAt sets the expiration time of the key stored by the session, if it is still in the session's storage.
+func (m *ReqCache[K, T]) expireAt(requestKey uint64, key K, t time.Time) {
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if e, ok := shard.data[requestKey]; ok && e.backend.Contains(key) {
+		m.setExpiration(e, key, t)
+	}
+}
+
+// setExpiration sets the expiration time of the key in the session's entry.
+// Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) setExpiration(e *sessionData[K, T], key K, t time.Time) {
+	if len(e.expirations) == 0 {
+		atomic.AddInt32(&m.expiringSessions, 1)
+		if e.expirations == nil {
+			e.expirations = make(map[K]time.Time)
+		}
+	}
+	e.expirations[key] = t
+}
+
+// forgetExpirations removes the expiration times of the keys that left the session's storage.
+// Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) forgetExpirations(e *sessionData[K, T], keys ...K) {
+	if len(e.expirations) == 0 {
+		return
+	}
+
+	for _, key := range keys {
+		delete(e.expirations, key)
+	}
+
+	if len(e.expirations) == 0 {
+		atomic.AddInt32(&m.expiringSessions, -1)
+	}
+}
+
+// moveExpiration moves the expiration time of the from key to the to key moved by Move,
+// replacing the expiration time of the to key. Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) moveExpiration(e *sessionData[K, T], from, to K) {
+	t, ok := e.expirations[from]
+	m.forgetExpirations(e, from, to)
+	if ok {
+		m.setExpiration(e, to, t)
+	}
+}
@@ -0,0 +1,266 @@
+package reqcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestReqCache_GetOrFetchControlled(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New[string, reqCacheTestObject](0, 10, WithClock(func() time.Time { return now }))
+
+	_, err := cache.GetOrFetchControlled(context.Background(), "key",
+		func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+			return nil, CacheControl{}, nil
+		})
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	var fetches int
+	fetcher := func(control CacheControl) func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+		return func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+			fetches++
+			return &reqCacheTestObject{value: fetches}, control, nil
+		}
+	}
+
+	t.Run("no store", func(t *testing.T) {
+		for i := 1; i <= 2; i++ {
+			v, err := cache.GetOrFetchControlled(ctx, "no-store", fetcher(CacheControl{NoStore: true}))
+			require.NoError(t, err)
+			require.Equal(t, i, v.value)
+			require.False(t, cache.Exists(ctx, "no-store"))
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		fetches = 0
+
+		v, err := cache.GetOrFetchControlled(ctx, "ttl", fetcher(CacheControl{TTL: time.Minute}))
+		require.NoError(t, err)
+		require.Equal(t, 1, v.value)
+
+		now = now.Add(59 * time.Second)
+		v, err = cache.GetOrFetchControlled(ctx, "ttl", fetcher(CacheControl{TTL: time.Minute}))
+		require.NoError(t, err)
+		require.Equal(t, 1, v.value, "Fresh data must be taken from the cache")
+
+		now = now.Add(time.Second)
+		_, ok := cache.Get(ctx, "ttl")
+		require.False(t, ok, "Expired data must be a miss")
+		require.False(t, cache.Exists(ctx, "ttl"))
+
+		v, err = cache.GetOrFetchControlled(ctx, "ttl", fetcher(CacheControl{}))
+		require.NoError(t, err)
+		require.Equal(t, 2, v.value)
+
+		// Without TTL, the data doesn't expire
+		now = now.Add(time.Hour)
+		v, ok = cache.Get(ctx, "ttl")
+		require.True(t, ok)
+		require.Equal(t, 2, v.value)
+	})
+
+	t.Run("put resets ttl", func(t *testing.T) {
+		_, err := cache.GetOrFetchControlled(ctx, "put", fetcher(CacheControl{TTL: time.Minute}))
+		require.NoError(t, err)
+		require.NoError(t, cache.Put(ctx, "put", &reqCacheTestObject{value: 100}))
+
+		now = now.Add(time.Hour)
+		v, ok := cache.Get(ctx, "put")
+		require.True(t, ok)
+		require.Equal(t, 100, v.value)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errFetch := errors.New("fetch failed")
+		_, err := cache.GetOrFetchControlled(ctx, "error",
+			func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+				return nil, CacheControl{}, errFetch
+			})
+		require.ErrorIs(t, err, errFetch)
+		require.False(t, cache.Exists(ctx, "error"))
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		_, err := cache.GetOrFetchControlled(ctx, "panic",
+			func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+				panic("boom")
+			})
+		require.ErrorIs(t, err, ErrFetcherPanicked)
+		require.False(t, cache.Exists(ctx, "panic"))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		_, err := cache.GetOrFetchControlled(canceled, "canceled",
+			func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+				cancel()
+				return &reqCacheTestObject{}, CacheControl{TTL: time.Minute}, nil
+			})
+		require.ErrorIs(t, err, context.Canceled)
+		require.False(t, cache.Exists(ctx, "canceled"), "Data fetched for a canceled context must not be cached")
+	})
+}
+
+func TestReqCache_GetOrFetchControlledShared(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New[string, reqCacheTestObject](0, 10, WithClock(func() time.Time { return now }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	var (
+		fetches  int32
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		errGroup errgroup.Group
+	)
+
+	fetcher := func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return &reqCacheTestObject{value: 1}, CacheControl{TTL: time.Minute}, nil
+	}
+
+	results := make([]*reqCacheTestObject, 2)
+	errGroup.Go(func() error {
+		var err error
+		results[0], err = cache.GetOrFetchControlled(ctx, "key", fetcher)
+		return err
+	})
+
+	<-started
+	errGroup.Go(func() error {
+		var err error
+		results[1], err = cache.GetOrFetchControlled(ctx, "key", fetcher)
+		return err
+	})
+
+	// Give the second call time to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	require.NoError(t, errGroup.Wait())
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	require.Same(t, results[0], results[1])
+
+	// Both calls stored the data with the TTL of the shared call
+	now = now.Add(time.Minute)
+	require.False(t, cache.Exists(ctx, "key"))
+}
+
+func TestReqCache_TTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](0, 10, WithLogger("test", logger),
+		WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for _, key := range []string{"get", "exists", "peek", "idle"} {
+		require.NoError(t, cache.Put(ctx, key, &reqCacheTestObject{value: 1}))
+	}
+
+	// Reading doesn't extend the TTL
+	now = now.Add(59 * time.Second)
+	_, ok := cache.Get(ctx, "get")
+	require.True(t, ok)
+	require.True(t, cache.Exists(ctx, "exists"))
+	_, ok, err := cache.Peek(ctx, "peek")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = cache.Get(ctx, "get")
+	require.False(t, ok, "Expired data must be a miss")
+	require.False(t, cache.Exists(ctx, "exists"))
+	_, ok, err = cache.Peek(ctx, "peek")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, 3, logger.cacheMiss)
+
+	// The expired entries are deleted when accessed, others still occupy the storage
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"idle"}, keys)
+
+	// Storing again resets the expiration
+	require.NoError(t, cache.Put(ctx, "idle", &reqCacheTestObject{value: 2}))
+	now = now.Add(59 * time.Second)
+	v, ok := cache.Get(ctx, "idle")
+	require.True(t, ok)
+	require.Equal(t, 2, v.value)
+
+	// A TTL of GetOrFetchControlled overrides the option
+	_, err = cache.GetOrFetchControlled(ctx, "controlled",
+		func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+			return &reqCacheTestObject{value: 3}, CacheControl{TTL: time.Hour}, nil
+		})
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	require.True(t, cache.Exists(ctx, "controlled"))
+}
+
+func TestReqCache_TTLForgetsRemovedKeys(t *testing.T) {
+	t.Parallel()
+
+	const cacheSize = 10
+
+	cache := New[int, reqCacheTestObject](0, cacheSize, WithTTL(time.Minute))
+
+	ctx := NewSession(context.Background())
+	requestKey := fromContext(ctx)
+
+	expirations := func() int {
+		shard := cache.dataShard(requestKey)
+		shard.mu.RLock()
+		defer shard.mu.RUnlock()
+
+		return len(shard.data[requestKey].expirations)
+	}
+
+	// Evicted keys are forgotten
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+	require.Equal(t, cacheSize, expirations())
+
+	// So are deleted ones
+	require.True(t, cache.Delete(ctx, 999))
+	require.Equal(t, cacheSize-1, expirations())
+
+	// Only the sessions with expiring entries check the expiration times
+	require.Equal(t, int32(1), atomic.LoadInt32(&cache.expiringSessions))
+	require.NoError(t, cache.EndSession(ctx))
+	require.Zero(t, atomic.LoadInt32(&cache.expiringSessions))
+
+	// Storing the data without TTL again clears the flag of the session
+	plain := New[int, reqCacheTestObject](0, cacheSize)
+	ctx = NewSession(context.Background())
+	defer plain.EndSession(ctx)
+	_, err := plain.GetOrFetchControlled(ctx, 1, func(context.Context) (*reqCacheTestObject, CacheControl, error) {
+		return &reqCacheTestObject{value: 1}, CacheControl{TTL: time.Hour}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&plain.expiringSessions))
+	require.NoError(t, plain.Put(ctx, 1, &reqCacheTestObject{value: 2}))
+	require.Zero(t, atomic.LoadInt32(&plain.expiringSessions))
+}
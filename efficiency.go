@@ -0,0 +1,62 @@
+package reqcache
+
+import "context"
+
+// WithEfficiencyTracking makes the cache remember the distinct keys requested by each session and the keys
+// that required a fetch, so SessionEfficiency can tell a high hit ratio caused by rereading a few keys
+// from genuine reuse. It costs a map insertion per lookup, so it is disabled by default.
+func WithEfficiencyTracking() Option {
+	return func(c *options) {
+		c.efficiencyTracking = true
+	}
+}
+
+// SessionEfficiency returns the number of distinct keys the session requested by Get, Exists, GetOrPut,
+// GetOrFetch and similar methods, and the number of them that required a fetcher call.
+// Returns ErrEfficiencyTrackingDisabled if WithEfficiencyTracking isn't set.
+func (m *ReqCache[K, T]) SessionEfficiency(ctx context.Context) (int, int, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !m.op.efficiencyTracking {
+		return 0, 0, ErrEfficiencyTrackingDisabled
+	}
+
+	state, ok := m.lookupSession(requestKey)
+
+	if !ok {
+		return 0, 0, nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.extra == nil {
+		return 0, 0, nil
+	}
+
+	return len(state.extra.requestedKeys), len(state.extra.fetchedKeys), nil
+}
+
+// trackKeys remembers the keys as requested by the session and, if fetched is true, as fetched.
+func (m *ReqCache[K, T]) trackKeys(ctx context.Context, fetched bool, keys ...K) {
+	state := m.trackSession(ctx, fromContext(ctx))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	x := state.extras()
+	if x.requestedKeys == nil {
+		x.requestedKeys = make(map[K]struct{})
+		x.fetchedKeys = make(map[K]struct{})
+	}
+
+	for _, k := range keys {
+		x.requestedKeys[k] = struct{}{}
+		if fetched {
+			x.fetchedKeys[k] = struct{}{}
+		}
+	}
+}
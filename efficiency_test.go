@@ -0,0 +1,81 @@
+//nolint:exhaustruct // tests
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_SessionEfficiency(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10, WithEfficiencyTracking())
+
+	_, _, err := cache.SessionEfficiency(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	unique, fetched, err := cache.SessionEfficiency(ctx)
+	require.NoError(t, err)
+	require.Zero(t, unique)
+	require.Zero(t, fetched)
+
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{}, nil
+	}
+
+	// One key read many times is fetched once
+	for i := 0; i < 100; i++ {
+		_, err = cache.GetOrFetch(ctx, "hot", fetcher)
+		require.NoError(t, err)
+	}
+
+	// A key put by the caller is requested, but not fetched
+	require.NoError(t, cache.Put(ctx, "put", &reqCacheTestObject{}))
+	cache.Get(ctx, "put")
+	cache.Exists(ctx, "put")
+
+	// A missing key is requested
+	cache.Get(ctx, "missing")
+
+	_, err = cache.GetOrFetchMany(ctx, []string{"hot", "a", "b"},
+		func(_ context.Context, missing []string) (map[string]*reqCacheTestObject, error) {
+			res := make(map[string]*reqCacheTestObject, len(missing))
+			for _, k := range missing {
+				res[k] = &reqCacheTestObject{}
+			}
+			return res, nil
+		})
+	require.NoError(t, err)
+
+	unique, fetched, err = cache.SessionEfficiency(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 5, unique, "hot, put, missing, a, b")
+	require.Equal(t, 3, fetched, "hot, a, b")
+
+	// Other sessions are counted separately
+	ctx2 := NewSession(context.Background())
+	defer cache.EndSession(ctx2)
+
+	cache.Get(ctx2, "hot")
+	unique, fetched, err = cache.SessionEfficiency(ctx2)
+	require.NoError(t, err)
+	require.Equal(t, 1, unique)
+	require.Zero(t, fetched)
+}
+
+func TestReqCache_SessionEfficiencyDisabled(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	_, _, err := cache.SessionEfficiency(ctx)
+	require.ErrorIs(t, err, ErrEfficiencyTrackingDisabled)
+}
@@ -0,0 +1,39 @@
+package reqcache
+
+import "errors"
+
+var (
+	// ErrNoSessionInContext is returned when the context has no reqcache session, i.e. NewSession was not called.
+	ErrNoSessionInContext = errors.New("no reqcache session in context")
+	// ErrSessionAlreadyStarted is returned when a session is started for a context that already has one.
+	ErrSessionAlreadyStarted = errors.New("context already has a reqcache session")
+	// ErrEmptyNamespace is returned by NewSessionNamespaced if the namespace is empty.
+	ErrEmptyNamespace = errors.New("empty reqcache session namespace")
+	// ErrNegativeObjectSize is returned by NewSessionSized if the number of objects is negative.
+	ErrNegativeObjectSize = errors.New("negative reqcache session object size")
+	// ErrInvalidSessionID is returned when a session id can't belong to any session.
+	ErrInvalidSessionID = errors.New("invalid reqcache session id")
+	// ErrNilValue is returned by Put for nil values if WithRejectNil is set.
+	ErrNilValue = errors.New("nil value can't be cached")
+	// ErrNoKeys is returned by methods that require at least one key when none were passed.
+	ErrNoKeys = errors.New("no keys")
+	// ErrResizeNotSupported is returned when an operation requires a backend implementing Resizer.
+	ErrResizeNotSupported = errors.New("backend doesn't support resizing")
+	// ErrWrongSessionOwner is returned when a context that doesn't own the session tries to end it.
+	ErrWrongSessionOwner = errors.New("context is not the reqcache session owner")
+	// ErrUnexpectedFetcherKey is returned by GetOrFetchMany if WithStrictFetcherResults is set
+	// and the fetcher returned a key that wasn't requested.
+	ErrUnexpectedFetcherKey = errors.New("fetcher returned a key that wasn't requested")
+	// ErrEfficiencyTrackingDisabled is returned by SessionEfficiency if WithEfficiencyTracking isn't set.
+	ErrEfficiencyTrackingDisabled = errors.New("reqcache efficiency tracking is disabled")
+	// ErrFetcherPanicked is returned to all callers sharing a fetcher call that panicked.
+	ErrFetcherPanicked = errors.New("reqcache fetcher panicked")
+	// ErrReplayDiverged is returned by Replay if a replayed operation has a different result than the recorded one.
+	ErrReplayDiverged = errors.New("replayed reqcache operation diverged from the recording")
+	// ErrInvalidConfig is returned by Builder.Build if the configuration of the cache is invalid.
+	ErrInvalidConfig = errors.New("invalid reqcache configuration")
+	// ErrObjectBudgetExceeded is returned by TryNewObject if the session has used up the budget set by WithObjectBudget.
+	ErrObjectBudgetExceeded = errors.New("reqcache object budget of the session exceeded")
+	// ErrInvariantViolated is wrapped by the errors returned by CheckInvariants.
+	ErrInvariantViolated = errors.New("reqcache invariant violated")
+)
@@ -0,0 +1,86 @@
+package reqcache
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+//nolint:gochecknoglobals // serializes the lookup and creation of the process-wide expvar maps
+var muExpvar sync.Mutex
+
+// expvarCounters contains the counters published by WithExpvar.
+type expvarCounters struct {
+	hits         *expvar.Int
+	misses       *expvar.Int
+	overflows    *expvar.Int
+	liveSessions *expvar.Int
+}
+
+// WithExpvar publishes the cache counters with the expvar package as a map with the given name.
+// The map contains "hits" and "misses" of Get and Exists, "overflows" (the number of objects allocated
+// beyond the preallocated memory, updated when sessions end) and "live_sessions" (the number of sessions
+// that use the cache). Caches created with the same name share the map.
+// New panics if a variable with the name is published and isn't an *expvar.Map.
+func WithExpvar(name string) Option {
+	return func(c *options) {
+		c.expvarName = name
+	}
+}
+
+// ObservabilityMode selects which sinks receive the cache hits and misses and the object pool usage,
+// if both the logger and the metrics (the expvar counters or the logger set by WithMetricsLogger) are set.
+type ObservabilityMode int
+
+const (
+	// ObservabilityBoth reports the events both to the logger and to the expvar counters.
+	ObservabilityBoth ObservabilityMode = iota
+	// ObservabilityLoggerOnly reports the events only to the logger, WithExpvar is ignored,
+	// and the logger set by WithMetricsLogger doesn't receive them.
+	ObservabilityLoggerOnly
+	// ObservabilityMetricsOnly reports the events only to the metrics. The logger doesn't receive
+	// LogCacheHitRatio and LogObjectPoolHitRatio calls, but still receives the other notifications.
+	ObservabilityMetricsOnly
+)
+
+// WithObservabilityMode sets which sinks receive the events reported on every call, so dashboards consuming
+// both the logger and the expvar counters don't count them twice. The default is ObservabilityBoth.
+func WithObservabilityMode(mode ObservabilityMode) Option {
+	return func(c *options) {
+		c.observabilityMode = mode
+	}
+}
+
+// newExpvarCounters returns the counters of the expvar map with the given name, publishing the map if needed.
+func newExpvarCounters(name string) *expvarCounters {
+	muExpvar.Lock()
+	defer muExpvar.Unlock()
+
+	var vars *expvar.Map
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		vars = expvar.NewMap(name)
+	case *expvar.Map:
+		vars = v
+	default:
+		panic(fmt.Sprintf("expvar %q is already published with type %T", name, v))
+	}
+
+	counter := func(key string) *expvar.Int {
+		vars.Add(key, 0) // creates the counter if it doesn't exist
+
+		v, ok := vars.Get(key).(*expvar.Int)
+		if !ok {
+			panic(fmt.Sprintf("expvar %q contains %q which is not *expvar.Int", name, key))
+		}
+
+		return v
+	}
+
+	return &expvarCounters{
+		hits:         counter("hits"),
+		misses:       counter("misses"),
+		overflows:    counter("overflows"),
+		liveSessions: counter("live_sessions"),
+	}
+}
@@ -0,0 +1,176 @@
+package reqcache
+
+import (
+	"context"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_Expvar(t *testing.T) {
+	t.Parallel()
+
+	const name = "reqcache_test_expvar"
+
+	cache := New[string, reqCacheTestObject](1, 10, WithExpvar(name))
+
+	vars, ok := expvar.Get(name).(*expvar.Map)
+	require.True(t, ok)
+	value := func(key string) int64 {
+		v, _ := vars.Get(key).(*expvar.Int)
+		return v.Value()
+	}
+
+	ctx := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{}))
+	cache.Get(ctx, "key")
+	cache.Get(ctx, "missing")
+	cache.Exists(ctx, "missing")
+	cache.NewObject(ctx)
+	cache.NewObject(ctx)
+	cache.NewObject(ctx)
+
+	require.EqualValues(t, 1, value("hits"))
+	require.EqualValues(t, 2, value("misses"))
+	require.EqualValues(t, 1, value("live_sessions"))
+	require.EqualValues(t, 0, value("overflows"))
+
+	require.NoError(t, cache.EndSession(ctx))
+	require.NoError(t, cache.EndSession(ctx))
+	require.EqualValues(t, 0, value("live_sessions"))
+	require.EqualValues(t, 2, value("overflows"))
+
+	// The same name reuses the published map
+	other := New[int, int](0, 10, WithExpvar(name))
+	ctx = NewSession(context.Background())
+	require.NoError(t, other.Put(ctx, 1, new(int)))
+	other.Get(ctx, 2)
+	require.EqualValues(t, 3, value("misses"))
+	require.EqualValues(t, 1, value("live_sessions"))
+	require.NoError(t, other.EndSession(ctx))
+
+	expvar.NewString("reqcache_test_expvar_string")
+	require.Panics(t, func() {
+		New[int, int](0, 10, WithExpvar("reqcache_test_expvar_string"))
+	})
+}
+
+func TestReqCache_ObservabilityMode(t *testing.T) {
+	t.Parallel()
+
+	const name = "reqcache_test_observability"
+
+	vars := func(name string) func(key string) int64 {
+		m, _ := expvar.Get(name).(*expvar.Map)
+		return func(key string) int64 {
+			v, _ := m.Get(key).(*expvar.Int)
+			return v.Value()
+		}
+	}
+
+	t.Run("metrics only", func(t *testing.T) {
+		logger := &hookLogger{}
+		cache := New[string, reqCacheTestObject](1, 10, WithLogger("test", logger), WithExpvar(name+"_metrics"),
+			WithObservabilityMode(ObservabilityMetricsOnly))
+		value := vars(name + "_metrics")
+
+		ctx := NewSession(context.Background())
+		require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{}))
+		cache.Get(ctx, "key")
+		cache.Get(ctx, "missing")
+		cache.NewObject(ctx)
+		cache.NewObject(ctx)
+		require.NoError(t, cache.EndSession(ctx))
+
+		require.EqualValues(t, 1, value("hits"))
+		require.EqualValues(t, 1, value("misses"))
+		require.EqualValues(t, 1, value("overflows"))
+		require.InDelta(t, 0.5, cache.HitRatio(), 0)
+
+		require.Zero(t, logger.cacheHit+logger.cacheMiss, "Per-call events must not be logged")
+		require.Zero(t, logger.objHit+logger.objMiss, "Per-call events must not be logged")
+		require.Equal(t, 1, logger.starts, "Other notifications are still logged")
+	})
+
+	t.Run("logger only", func(t *testing.T) {
+		logger := &hookLogger{}
+		cache := New[string, reqCacheTestObject](1, 10, WithLogger("test", logger), WithExpvar(name+"_logger"),
+			WithObservabilityMode(ObservabilityLoggerOnly))
+
+		ctx := NewSession(context.Background())
+		cache.Get(ctx, "missing")
+		require.NoError(t, cache.EndSession(ctx))
+
+		require.Nil(t, expvar.Get(name+"_logger"), "Metrics must not be published")
+		require.Equal(t, 1, logger.cacheMiss)
+	})
+}
+
+func TestReqCache_MetricsLogger(t *testing.T) {
+	t.Parallel()
+
+	use := func(cache *ReqCache[string, reqCacheTestObject]) {
+		ctx := NewSession(context.Background())
+		require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{}))
+		cache.Get(ctx, "key")
+		cache.Get(ctx, "missing")
+		cache.NewObject(ctx)
+		_, err := cache.GetOrFetch(ctx, "fetched", func(context.Context) (*reqCacheTestObject, error) {
+			return &reqCacheTestObject{}, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, cache.EndSession(ctx))
+	}
+
+	t.Run("both", func(t *testing.T) {
+		logger, metrics := &hookLogger{}, &hookLogger{}
+		cache := New[string, reqCacheTestObject](1, 10, WithLogger("test", logger), WithMetricsLogger(metrics))
+		use(cache)
+
+		for _, l := range []*hookLogger{logger, metrics} {
+			require.Equal(t, 1, l.cacheHit)
+			require.Equal(t, 2, l.cacheMiss)
+			require.Equal(t, 1, l.objHit)
+			require.Equal(t, []string{"fetched"}, l.fetches)
+			require.Equal(t, 1, l.starts)
+			require.Len(t, l.ends, 1)
+			require.Equal(t, []int{2}, l.entries)
+		}
+
+		// SetLogger replaces only the logger
+		cache.SetLogger("test", nil)
+		use(cache)
+		require.Equal(t, 1, logger.starts)
+		require.Equal(t, 2, metrics.starts)
+		require.Equal(t, 2, metrics.cacheHit)
+	})
+
+	t.Run("without logger", func(t *testing.T) {
+		metrics := &hookLogger{}
+		use(New[string, reqCacheTestObject](1, 10, WithMetricsLogger(metrics)))
+
+		require.Equal(t, 1, metrics.cacheHit)
+		require.Equal(t, 1, metrics.starts)
+	})
+
+	t.Run("metrics only", func(t *testing.T) {
+		logger, metrics := &hookLogger{}, &hookLogger{}
+		use(New[string, reqCacheTestObject](1, 10, WithLogger("test", logger), WithMetricsLogger(metrics),
+			WithObservabilityMode(ObservabilityMetricsOnly)))
+
+		require.Zero(t, logger.cacheHit+logger.cacheMiss+logger.objHit)
+		require.Equal(t, 1, metrics.cacheHit)
+		require.Equal(t, 1, metrics.objHit)
+	})
+
+	t.Run("logger only", func(t *testing.T) {
+		logger, metrics := &hookLogger{}, &hookLogger{}
+		use(New[string, reqCacheTestObject](1, 10, WithLogger("test", logger), WithMetricsLogger(metrics),
+			WithObservabilityMode(ObservabilityLoggerOnly)))
+
+		require.Equal(t, 1, logger.cacheHit)
+		require.Zero(t, metrics.cacheHit+metrics.cacheMiss+metrics.objHit)
+		require.Equal(t, 1, metrics.starts, "Other notifications are still sent to the metrics logger")
+	})
+}
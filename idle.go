@@ -0,0 +1,98 @@
+package reqcache
+
+import (
+	"context"
+	"time"
+)
+
+// WithIdleTimeout makes Get treat the entries that were neither read by Get nor stored for longer than d as misses
+// and delete them. Unlike the age of the data checked by RefreshIfOlderThan, every Get resets the idle time,
+// so it suits long sessions with a shifting working set, e.g. streaming requests. The expired entries are removed
+// lazily by Get, other methods still see them. The time is taken from WithClock. By default, entries don't expire.
+// The access times are forgotten when the entries are deleted or evicted. Evictions are seen only if the backend
+// implements EvictionNotifier, otherwise the access times of evicted entries are kept until the session end.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *options) {
+		c.idleTimeout = d
+	}
+}
+
+// expireIdle deletes the entry if it is idle longer than WithIdleTimeout allows and returns true,
+// otherwise updates its last access time. The reads of a snapshot neither delete the entry nor update the time.
+func (m *ReqCache[K, T]) expireIdle(ctx context.Context, dataKey K) bool {
+	state := m.trackSession(ctx, fromContext(ctx))
+	key := m.effectiveKey(ctx, dataKey)
+	now := m.now()
+	_, snapshot := m.readSnapshot(ctx)
+
+	state.mu.Lock()
+	x := state.extras()
+	last, ok := x.accessTimes[key]
+	expired := ok && now.Sub(last) > m.op.idleTimeout
+	if snapshot {
+		state.mu.Unlock()
+		return expired
+	}
+	if expired {
+		delete(x.accessTimes, key)
+	} else {
+		state.touchLocked(key, now)
+	}
+	state.mu.Unlock()
+
+	if expired {
+		m.delete(ctx, dataKey)
+	}
+
+	return expired
+}
+
+// touch sets the last access time of the key used by WithIdleTimeout.
+func (s *sessionState[K, T]) touch(key K, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.touchLocked(key, t)
+}
+
+// touchLocked works like touch, but must be called under the state lock.
+func (s *sessionState[K, T]) touchLocked(key K, t time.Time) {
+	x := s.extras()
+	if x.accessTimes == nil {
+		x.accessTimes = make(map[K]time.Time)
+	}
+	x.accessTimes[key] = t
+}
+
+// forgetAccess removes the last access times of the keys that left the session's storage.
+func (s *sessionState[K, T]) forgetAccess(keys ...K) {
+	if len(keys) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.extra == nil {
+		return
+	}
+
+	for _, key := range keys {
+		delete(s.extra.accessTimes, key)
+	}
+}
+
+// moveAccess moves the last access time of the from key to the to key moved by Move.
+func (s *sessionState[K, T]) moveAccess(from, to K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.extra == nil {
+		return
+	}
+
+	if t, ok := s.extra.accessTimes[from]; ok {
+		delete(s.extra.accessTimes, from)
+		s.extra.accessTimes[to] = t
+	}
+}
@@ -0,0 +1,88 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_IdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](0, 10, WithLogger("test", logger),
+		WithIdleTimeout(time.Minute), WithClock(func() time.Time { return now }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "read", &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx, "idle", &reqCacheTestObject{value: 2}))
+
+	// Reading resets the idle time
+	for i := 0; i < 3; i++ {
+		now = now.Add(40 * time.Second)
+		v, ok := cache.Get(ctx, "read")
+		require.True(t, ok)
+		require.Equal(t, 1, v.value)
+	}
+
+	require.True(t, cache.Exists(ctx, "idle"), "Expired entries are removed lazily")
+	_, ok := cache.Get(ctx, "idle")
+	require.False(t, ok)
+	require.False(t, cache.Exists(ctx, "idle"), "Expired entry must be deleted")
+	require.Equal(t, 2, logger.cacheMiss, "Expired entry must be a miss for Get and then Exists")
+
+	// Storing resets the idle time as well
+	require.NoError(t, cache.Put(ctx, "idle", &reqCacheTestObject{value: 3}))
+	now = now.Add(time.Minute)
+	v, ok := cache.Get(ctx, "idle")
+	require.True(t, ok)
+	require.Equal(t, 3, v.value)
+}
+
+func TestReqCache_IdleTimeoutForgetsRemovedKeys(t *testing.T) {
+	t.Parallel()
+
+	const cacheSize = 10
+
+	cache := New[int, reqCacheTestObject](0, cacheSize, WithIdleTimeout(time.Minute))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	accessTimes := func() int {
+		state := cache.trackSession(ctx, fromContext(ctx))
+		state.mu.Lock()
+		defer state.mu.Unlock()
+
+		return len(state.extras().accessTimes)
+	}
+
+	// Evicted keys are forgotten
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+	require.Equal(t, cacheSize, accessTimes())
+
+	// So are deleted ones
+	require.True(t, cache.Delete(ctx, 999))
+	require.Equal(t, cacheSize-1, accessTimes())
+
+	// The access time of a moved entry moves with it
+	moved, err := cache.Move(ctx, 998, 2000)
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.Equal(t, cacheSize-1, accessTimes())
+
+	state := cache.trackSession(ctx, fromContext(ctx))
+	state.mu.Lock()
+	_, hasFrom := state.extras().accessTimes[998]
+	_, hasTo := state.extras().accessTimes[2000]
+	state.mu.Unlock()
+	require.False(t, hasFrom)
+	require.True(t, hasTo)
+}
@@ -0,0 +1,17 @@
+package reqcache
+
+import "context"
+
+// IReqCache is the interface of the basic ReqCache methods, e.g. for substituting the cache in tests.
+type IReqCache[K comparable, T any] interface {
+	NewObject(ctx context.Context) *T
+	Put(ctx context.Context, dataKey K, data *T) error
+	Get(ctx context.Context, dataKey K) (*T, bool)
+	Exists(ctx context.Context, dataKey K) bool
+	Delete(ctx context.Context, dataKey K) bool
+	GetOrFetch(ctx context.Context, dataKey K, fetcher func(context.Context) (*T, error)) (*T, error)
+	EndSession(ctx context.Context) error
+}
+
+// ReqCache must implement IReqCache, so the interface can't drift from the real signatures.
+var _ IReqCache[int, struct{}] = (*ReqCache[int, struct{}])(nil)
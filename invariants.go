@@ -0,0 +1,101 @@
+package reqcache
+
+import "fmt"
+
+// CheckInvariants verifies the internal consistency of the cache and returns an error describing all violations,
+// which wraps ErrInvariantViolated. It is intended for tests and debugging.
+// The checks are:
+//   - every session having data or objects in the cache is registered as a session using the cache;
+//   - the sessions using the cache are not ended (EndSession was not called for them on any cache), checked only for
+//     the sessions started after a cache with WithLeakThreshold or a session logger was created;
+//   - the object pools of the sessions are within bounds;
+//   - the session map used by WithLockFreeSessionMap matches the main one.
+//
+// It locks the whole cache and should be called when no operations are in flight,
+// otherwise it may report the transient states of concurrent calls.
+func (m *ReqCache[K, T]) CheckInvariants() error {
+	for _, shard := range m.dataShards {
+		shard.mu.RLock()
+	}
+	defer func() {
+		for _, shard := range m.dataShards {
+			shard.mu.RUnlock()
+		}
+	}()
+	for _, shard := range m.objectShards {
+		shard.mu.Lock()
+	}
+	defer func() {
+		for _, shard := range m.objectShards {
+			shard.mu.Unlock()
+		}
+	}()
+	for _, shard := range m.sessionShards {
+		shard.mu.Lock()
+	}
+	defer func() {
+		for _, shard := range m.sessionShards {
+			shard.mu.Unlock()
+		}
+	}()
+
+	var errs []error
+
+	sessionsWithData := 0
+	for i, shard := range m.dataShards {
+		sessionsWithData += len(shard.data)
+		for id := range shard.data {
+			if _, ok := m.sessionShard(id).sessions[id]; !ok {
+				errs = append(errs, fmt.Errorf("%w: session %d has data, but is not registered", ErrInvariantViolated, id))
+			}
+			if m.dataShard(id) != shard {
+				errs = append(errs, fmt.Errorf("%w: session %d is in the wrong data shard %d", ErrInvariantViolated, id, i))
+			}
+		}
+	}
+
+	if m.lockFreeData != nil {
+		n := 0
+		m.lockFreeData.Range(func(key, value any) bool {
+			n++
+			id, _ := key.(uint64)
+			if d, ok := m.dataShard(id).data[id]; !ok || d != value {
+				errs = append(errs, fmt.Errorf("%w: lock-free session map has stale data of session %d",
+					ErrInvariantViolated, id))
+			}
+			return true
+		})
+		if n != sessionsWithData {
+			errs = append(errs, fmt.Errorf("%w: lock-free session map has %d sessions, expected %d",
+				ErrInvariantViolated, n, sessionsWithData))
+		}
+	}
+
+	for i, shard := range m.objectShards {
+		for id, p := range shard.objects {
+			if _, ok := m.sessionShard(id).sessions[id]; !ok {
+				errs = append(errs, fmt.Errorf("%w: session %d has objects, but is not registered", ErrInvariantViolated, id))
+			}
+			if m.objectShard(id) != shard {
+				errs = append(errs, fmt.Errorf("%w: session %d is in the wrong object shard %d", ErrInvariantViolated, id, i))
+			}
+
+			if err := p.checkInvariants(); err != nil {
+				errs = append(errs, fmt.Errorf("%w: object pool of session %d: %s", ErrInvariantViolated, id, err.Error()))
+			}
+		}
+	}
+
+	for i, shard := range m.sessionShards {
+		for id := range shard.sessions {
+			if _, ok := liveSessionIDs.Load(id); liveRegistered(id) && !ok {
+				errs = append(errs, fmt.Errorf("%w: session %d is registered, but has ended", ErrInvariantViolated, id))
+			}
+			if m.sessionShard(id) != shard {
+				errs = append(errs, fmt.Errorf("%w: session %d is in the wrong session shard %d", ErrInvariantViolated, id, i))
+			}
+		}
+	}
+
+	return joinErrors(errs...)
+}
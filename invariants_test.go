@@ -0,0 +1,48 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_CheckInvariants(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](2, 2, WithLeakThreshold(1000)) // registers the live sessions
+	require.NoError(t, cache.CheckInvariants())
+
+	ctx1 := NewSession(context.Background())
+	ctx2 := NewSession(context.Background())
+	for i := 0; i < 3; i++ {
+		cache.NewObject(ctx1)
+		require.NoError(t, cache.Put(ctx1, "key", &reqCacheTestObject{}))
+		require.NoError(t, cache.Put(ctx2, "key", &reqCacheTestObject{}))
+	}
+	require.NoError(t, cache.CheckInvariants())
+
+	require.NoError(t, cache.EndSession(ctx1))
+	require.NoError(t, cache.CheckInvariants())
+
+	// Corrupt the object pool and forget the registration of the second session
+	id2 := fromContext(ctx2)
+	p := cache.objectsPool.Get(cache.objSize)
+	p.index = 10
+	cache.objectShard(id2).objects[id2] = p
+	delete(cache.sessionShard(id2).sessions, id2)
+
+	err := cache.CheckInvariants()
+	require.ErrorIs(t, err, ErrInvariantViolated)
+	require.Contains(t, err.Error(), "has data, but is not registered")
+	require.Contains(t, err.Error(), "has objects, but is not registered")
+	require.Contains(t, err.Error(), "index 10 is out of bounds [0, 2]")
+
+	// A registered session that has ended
+	id1 := fromContext(ctx1)
+	cache.sessionShard(id1).sessions[id1] = newSessionState[string, reqCacheTestObject]()
+	require.Contains(t, cache.CheckInvariants().Error(), "is registered, but has ended")
+
+	p.index = 0
+	require.NoError(t, cache.EndSession(ctx2))
+}
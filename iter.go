@@ -0,0 +1,28 @@
+//go:build go1.23
+
+package reqcache
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns an iterator over the entries of the session, from the oldest to the newest.
+// The entries are snapshotted when the iteration starts, so the cache can be modified during the iteration.
+// The recency of the entries is not updated. Panics if there is no session in the context.
+func (m *ReqCache[K, T]) All(ctx context.Context) iter.Seq2[K, *T] {
+	fromContext(ctx)
+
+	return func(yield func(K, *T) bool) {
+		keys, values, err := m.entries(ctx)
+		if err != nil {
+			panic(err)
+		}
+
+		for i, k := range keys {
+			if !yield(k, values[i]) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.23
+
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_All(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	require.Panics(t, func() { cache.All(context.Background()) })
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for range cache.All(ctx) {
+		t.Fatal("Empty session should have no entries")
+	}
+
+	for i, key := range []string{"key1", "key2", "key3"} {
+		require.NoError(t, cache.Put(ctx, key, &reqCacheTestObject{value: i}))
+	}
+
+	// All entries are yielded and the cache can be modified during the iteration
+	res := make(map[string]int)
+	for k, v := range cache.All(ctx) {
+		res[k] = v.value
+		cache.Delete(ctx, k)
+	}
+	require.Equal(t, map[string]int{"key1": 0, "key2": 1, "key3": 2}, res)
+
+	// Break stops the iteration
+	for i, key := range []string{"key1", "key2", "key3"} {
+		require.NoError(t, cache.Put(ctx, key, &reqCacheTestObject{value: i}))
+	}
+
+	var keys []string
+	for k := range cache.All(ctx) {
+		keys = append(keys, k)
+		if len(keys) == 2 {
+			break
+		}
+	}
+	require.Equal(t, []string{"key1", "key2"}, keys)
+}
@@ -0,0 +1,10 @@
+//go:build go1.20
+
+package reqcache
+
+import "errors"
+
+// joinErrors returns an error that wraps the given errors, nil if there are none.
+func joinErrors(errs ...error) error {
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+//go:build !go1.20
+
+package reqcache
+
+import (
+	"errors"
+	"strings"
+)
+
+// joinErrors returns an error that wraps the given errors, nil if there are none.
+// It is a replacement of errors.Join for Go versions before 1.20.
+func joinErrors(errs ...error) error {
+	var joined joinError
+	for _, err := range errs {
+		if err != nil {
+			joined.errs = append(joined.errs, err)
+		}
+	}
+
+	if len(joined.errs) == 0 {
+		return nil
+	}
+
+	return &joined
+}
+
+// joinError is returned by joinErrors.
+type joinError struct {
+	errs []error
+}
+
+// Error returns the messages of the wrapped errors separated by newlines, like errors.Join.
+func (e *joinError) Error() string {
+	msgs := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Is reports whether any of the wrapped errors matches target.
+func (e *joinError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first wrapped error that matches target.
+func (e *joinError) As(target any) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unwrap returns the wrapped errors.
+func (e *joinError) Unwrap() []error {
+	return e.errs
+}
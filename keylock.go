@@ -0,0 +1,123 @@
+package reqcache
+
+import (
+	"math"
+	"reflect"
+	"sync"
+)
+
+// keyLockStripes is the number of the key locks of a session. Keys are spread over the locks by their hash,
+// so the memory of the locks doesn't grow with the number of updated keys.
+const keyLockStripes = 64
+
+// keyLocks is the fixed set of the key locks of a session.
+type keyLocks [keyLockStripes]sync.Mutex
+
+// FNV-1a parameters used to hash the keys.
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// keyLockStripe returns the index of the lock of the key. Equal keys always get the same index.
+// Strings and integers are hashed directly, other keys are hashed by their values with reflection.
+func keyLockStripe[K comparable](key K) int {
+	var h uint64
+	switch k := any(key).(type) {
+	case string:
+		h = hashString(fnvOffset, k)
+	case int:
+		h = hashUint(fnvOffset, uint64(k))
+	case int64:
+		h = hashUint(fnvOffset, uint64(k))
+	case int32:
+		h = hashUint(fnvOffset, uint64(k))
+	case uint:
+		h = hashUint(fnvOffset, uint64(k))
+	case uint64:
+		h = hashUint(fnvOffset, k)
+	case uint32:
+		h = hashUint(fnvOffset, uint64(k))
+	default:
+		h = hashValue(fnvOffset, reflect.ValueOf(k))
+	}
+
+	return int(h % keyLockStripes)
+}
+
+// hashString adds the string to the hash.
+func hashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime
+	}
+
+	return h
+}
+
+// hashUint adds the 8 bytes of the number to the hash.
+func hashUint(h, v uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= v & 0xff
+		h *= fnvPrime
+		v >>= 8
+	}
+
+	return h
+}
+
+// hashFloat adds the number to the hash. Positive and negative zeros are equal, so they hash the same.
+func hashFloat(h uint64, f float64) uint64 {
+	if f == 0 {
+		f = 0
+	}
+
+	return hashUint(h, math.Float64bits(f))
+}
+
+// hashValue adds the value of a comparable type to the hash. Pointers and channels are hashed by address,
+// interfaces by their dynamic values.
+func hashValue(h uint64, v reflect.Value) uint64 {
+	//nolint:exhaustive // the remaining kinds are not comparable or have no value to hash
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return hashUint(h, 1)
+		}
+
+		return hashUint(h, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return hashUint(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return hashUint(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(h, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return hashFloat(hashFloat(h, real(c)), imag(c))
+	case reflect.String:
+		return hashString(h, v.String())
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		return hashUint(h, uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			return h
+		}
+
+		return hashValue(h, v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			h = hashValue(h, v.Index(i))
+		}
+
+		return h
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			h = hashValue(h, v.Field(i))
+		}
+
+		return h
+	default:
+		return h
+	}
+}
@@ -0,0 +1,67 @@
+package reqcache
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLockStripe(t *testing.T) {
+	t.Parallel()
+
+	type structKey struct {
+		ID    int
+		Name  string
+		Ratio float64
+		Ptr   *int
+		Pair  [2]uint8
+	}
+
+	x := 1
+
+	// Equal keys get the same stripe
+	require.Equal(t, keyLockStripe("key"), keyLockStripe("key"))
+	require.Equal(t,
+		keyLockStripe(structKey{ID: 1, Name: "a", Ratio: 0, Ptr: &x, Pair: [2]uint8{1, 2}}),
+		keyLockStripe(structKey{ID: 1, Name: "a", Ratio: math.Copysign(0, -1), Ptr: &x, Pair: [2]uint8{1, 2}}))
+
+	// Interfaces, possible as keys since Go 1.20, are hashed by their dynamic values
+	var iface any = "key"
+	require.Equal(t, hashString(fnvOffset, "key"), hashValue(fnvOffset, reflect.ValueOf(&iface).Elem()))
+
+	// Keys are spread over all the stripes
+	strings := make(map[int]struct{})
+	ints := make(map[int]struct{})
+	structs := make(map[int]struct{})
+	for i := 0; i < 100*keyLockStripes; i++ {
+		strings[keyLockStripe(strconv.Itoa(i))] = struct{}{}
+		ints[keyLockStripe(i)] = struct{}{}
+		structs[keyLockStripe(structKey{ID: i})] = struct{}{} //nolint:exhaustruct // only the id matters
+	}
+	require.Len(t, strings, keyLockStripes)
+	require.Len(t, ints, keyLockStripes)
+	require.Len(t, structs, keyLockStripes)
+}
+
+func TestReqCache_KeyLockStripes(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](10, 10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// The number of the locks doesn't grow with the number of keys
+	locks := make(map[sync.Locker]struct{})
+	for i := 0; i < 10*keyLockStripes; i++ {
+		lock, err := cache.keyLock(ctx, strconv.Itoa(i))
+		require.NoError(t, err)
+		locks[lock] = struct{}{}
+	}
+	require.Len(t, locks, keyLockStripes)
+}
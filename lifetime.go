@@ -0,0 +1,71 @@
+package reqcache
+
+import "sync/atomic"
+
+// LifetimeStats contains the counters of the cache aggregated across all sessions.
+type LifetimeStats struct {
+	// Puts is the number of entries stored by Put, PutMany and PutIfAbsent,
+	// Gets and Deletes are the numbers of Get and Delete calls.
+	Puts    uint64
+	Gets    uint64
+	Deletes uint64
+	// Hits and Misses are the lookup results counted by HitRatio.
+	Hits   uint64
+	Misses uint64
+	// SessionsStarted is the number of sessions that used the cache, SessionsEnded is the number of them ended.
+	SessionsStarted uint64
+	SessionsEnded   uint64
+	// Overflows is the number of objects allocated after the preallocated objects of the sessions were exhausted.
+	Overflows uint64
+}
+
+// lifetimeCounters contains the counters for LifetimeStats. It is accessed atomically.
+type lifetimeCounters struct {
+	puts            uint64
+	deletes         uint64
+	getsAtReset     uint64 // values of the lookup counters of the cache at the last ResetLifetimeStats call
+	hitsAtReset     uint64
+	missesAtReset   uint64
+	sessionsStarted uint64
+	sessionsEnded   uint64
+	overflows       uint64
+}
+
+// LifetimeStats returns the counters of the cache aggregated across all sessions
+// since the cache creation or the last ResetLifetimeStats call. Unlike the logger, it doesn't need any setup.
+func (m *ReqCache[K, T]) LifetimeStats() LifetimeStats {
+	c := &m.lifetime
+
+	// the counters only grow, so they are taken after their values at the reset to not get below them
+	hitsAtReset, missesAtReset := atomic.LoadUint64(&c.hitsAtReset), atomic.LoadUint64(&c.missesAtReset)
+	getsAtReset := atomic.LoadUint64(&c.getsAtReset)
+	hits, misses, gets := m.lookups.load()
+
+	return LifetimeStats{
+		Puts:            atomic.LoadUint64(&c.puts),
+		Gets:            gets - getsAtReset,
+		Deletes:         atomic.LoadUint64(&c.deletes),
+		Hits:            hits - hitsAtReset,
+		Misses:          misses - missesAtReset,
+		SessionsStarted: atomic.LoadUint64(&c.sessionsStarted),
+		SessionsEnded:   atomic.LoadUint64(&c.sessionsEnded),
+		Overflows:       atomic.LoadUint64(&c.overflows),
+	}
+}
+
+// ResetLifetimeStats resets the counters returned by LifetimeStats.
+// It is intended for tests.
+func (m *ReqCache[K, T]) ResetLifetimeStats() {
+	c := &m.lifetime
+
+	hits, misses, gets := m.lookups.load()
+
+	atomic.StoreUint64(&c.puts, 0)
+	atomic.StoreUint64(&c.deletes, 0)
+	atomic.StoreUint64(&c.getsAtReset, gets)
+	atomic.StoreUint64(&c.hitsAtReset, hits)
+	atomic.StoreUint64(&c.missesAtReset, misses)
+	atomic.StoreUint64(&c.sessionsStarted, 0)
+	atomic.StoreUint64(&c.sessionsEnded, 0)
+	atomic.StoreUint64(&c.overflows, 0)
+}
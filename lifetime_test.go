@@ -0,0 +1,63 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_LifetimeStats(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](1, 10)
+	require.Equal(t, LifetimeStats{}, cache.LifetimeStats())
+
+	for s := 0; s < 2; s++ {
+		ctx := NewSession(context.Background())
+		require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+		require.NoError(t, cache.Put(ctx, 2, &reqCacheTestObject{value: 2}))
+		_, _ = cache.Get(ctx, 1)
+		_, _ = cache.Get(ctx, 3)
+		cache.Exists(ctx, 2)
+		cache.Delete(ctx, 1)
+		cache.Delete(ctx, 1)
+		for i := 0; i < 3; i++ {
+			cache.NewObject(ctx)
+		}
+		require.NoError(t, cache.EndSession(ctx))
+	}
+
+	live := NewSession(context.Background())
+	defer cache.EndSession(live)
+	require.NoError(t, cache.Put(live, 1, &reqCacheTestObject{value: 1}))
+	_, _ = cache.Get(live, 1)
+
+	require.Equal(t, LifetimeStats{
+		Puts:            5,
+		Gets:            5,
+		Deletes:         4,
+		Hits:            5,
+		Misses:          2,
+		SessionsStarted: 3,
+		SessionsEnded:   2,
+		Overflows:       4,
+	}, cache.LifetimeStats())
+
+	cache.ResetLifetimeStats()
+	require.Equal(t, LifetimeStats{}, cache.LifetimeStats())
+
+	// The lookups of the live session are counted from the reset, also after the session ends
+	_, _ = cache.Get(live, 1)
+	require.NoError(t, cache.EndSession(live))
+	require.Equal(t, LifetimeStats{
+		Puts:            0,
+		Gets:            1,
+		Deletes:         0,
+		Hits:            1,
+		Misses:          0,
+		SessionsStarted: 0,
+		SessionsEnded:   1,
+		Overflows:       0,
+	}, cache.LifetimeStats())
+}
@@ -0,0 +1,128 @@
+package reqcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// loggerHolder contains the logger and the cache name passed to it. They can be replaced by SetLogger.
+// It also contains the logger set by WithMetricsLogger, which is notified together with the logger.
+type loggerHolder struct {
+	enabled uint32 // 1 if any logger is not nil, accessed atomically to skip locking on hot paths without a logger
+
+	perCallDisabled        bool    // set by ObservabilityMetricsOnly, immutable after New
+	metricsPerCallDisabled bool    // set by ObservabilityLoggerOnly, immutable after New
+	metrics                ILogger // set by WithMetricsLogger, immutable after New
+
+	mu     sync.RWMutex
+	name   string
+	logger ILogger
+}
+
+// newLoggerHolder creates a new loggerHolder.
+func newLoggerHolder(name string, logger ILogger) *loggerHolder {
+	h := &loggerHolder{
+		enabled:                0,
+		perCallDisabled:        false,
+		metricsPerCallDisabled: false,
+		metrics:                nil,
+		mu:                     sync.RWMutex{},
+		name:                   "",
+		logger:                 nil,
+	}
+	h.set(name, logger)
+
+	return h
+}
+
+// get returns the name to pass to the logger and the logger. Both are empty if logging is disabled.
+// The name is the operation name of the session in the context if it was set by NewSessionNamed,
+// otherwise the cache name.
+func (h *loggerHolder) get(ctx context.Context) (string, ILogger) {
+	if atomic.LoadUint32(&h.enabled) == 0 {
+		return "", nil
+	}
+
+	h.mu.RLock()
+	name, logger := h.name, h.logger
+	h.mu.RUnlock()
+
+	if logger != nil {
+		name = sessionName(ctx, name)
+	}
+
+	return name, logger
+}
+
+// getAll works like get, but returns the logger together with the logger set by WithMetricsLogger.
+// Either of them may be nil.
+func (h *loggerHolder) getAll(ctx context.Context) (string, [2]ILogger) {
+	if atomic.LoadUint32(&h.enabled) == 0 {
+		return "", [2]ILogger{}
+	}
+
+	h.mu.RLock()
+	name, logger := h.name, h.logger
+	h.mu.RUnlock()
+
+	return sessionName(ctx, name), [2]ILogger{logger, h.metrics}
+}
+
+// nameFor returns the name to pass to the callbacks, like get does, even if logging is disabled.
+func (h *loggerHolder) nameFor(ctx context.Context) string {
+	h.mu.RLock()
+	name := h.name
+	h.mu.RUnlock()
+
+	return sessionName(ctx, name)
+}
+
+// sessionName returns the operation name of the session in the context if it was set by NewSessionNamed,
+// otherwise the cache name.
+func sessionName(ctx context.Context, cacheName string) string {
+	if c := sessionOf(ctx); c != nil && c.session.names != nil && c.session.names.opName != "" {
+		return c.session.names.opName
+	}
+
+	return cacheName
+}
+
+// getPerCall works like getAll for the events reported on every call (cache and object pool hits),
+// which are not sent to the logger in ObservabilityMetricsOnly mode and to the metrics logger
+// in ObservabilityLoggerOnly mode.
+func (h *loggerHolder) getPerCall(ctx context.Context) (string, [2]ILogger) {
+	name, loggers := h.getAll(ctx)
+	if h.perCallDisabled {
+		loggers[0] = nil
+	}
+	if h.metricsPerCallDisabled {
+		loggers[1] = nil
+	}
+
+	return name, loggers
+}
+
+// set replaces the cache name and the logger.
+func (h *loggerHolder) set(name string, logger ILogger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.name = name
+	h.logger = logger
+
+	if logger != nil || h.metrics != nil {
+		atomic.StoreUint32(&h.enabled, 1)
+	} else {
+		atomic.StoreUint32(&h.enabled, 0)
+	}
+}
+
+// setMetrics sets the logger set by WithMetricsLogger. Must be called before the cache is used.
+func (h *loggerHolder) setMetrics(logger ILogger) {
+	h.mu.Lock()
+	h.metrics = logger
+	h.mu.Unlock()
+
+	h.set(h.name, h.logger)
+}
@@ -0,0 +1,35 @@
+package reqcache
+
+import (
+	"context"
+	"net/http"
+)
+
+// SessionEnder is a cache ending the sessions of the contexts, e.g. ReqCache, ValueCache, AnyCache or ObjectPool.
+type SessionEnder interface {
+	EndSession(ctx context.Context) error
+}
+
+// Middleware returns an HTTP middleware that starts a session for every request and ends it in all the caches
+// after the handler returns, even if it panics. The caches share the session, so it is started once.
+// If the request context already has a session, the request is passed as is and the session isn't ended,
+// it belongs to the code that started it. The errors of EndSession are ignored.
+func Middleware(caches ...SessionEnder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if InContext(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := NewSession(r.Context())
+			defer func() {
+				for _, c := range caches {
+					_ = c.EndSession(ctx)
+				}
+			}()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
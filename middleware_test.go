@@ -0,0 +1,58 @@
+package reqcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sessionLive reports whether the session of the context hasn't ended.
+func sessionLive(ctx context.Context) bool {
+	return atomic.LoadUint32(sessionLiveFlag(ctx)) == 1
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](1, 10)
+	values := NewValueCache[string, int](0, 10)
+
+	var sessionCtx context.Context
+	handler := Middleware(cache, values)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		sessionCtx = r.Context()
+		require.True(t, InContext(sessionCtx))
+		require.NoError(t, cache.Put(sessionCtx, "key", cache.NewObject(sessionCtx)))
+		require.NoError(t, values.Put(sessionCtx, "key", 1))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NotNil(t, sessionCtx)
+	require.False(t, sessionLive(sessionCtx), "The session must be ended")
+	require.NoError(t, cache.CheckInvariants())
+
+	// The session is ended even if the handler panics
+	panicking := Middleware(cache)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		sessionCtx = r.Context()
+		cache.NewObject(sessionCtx)
+		panic("handler failed")
+	}))
+	require.Panics(t, func() {
+		panicking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	require.False(t, sessionLive(sessionCtx))
+
+	// An existing session is reused and not ended
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	nested := Middleware(cache)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		sessionCtx = r.Context()
+	}))
+	nested.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	require.Equal(t, ctx, sessionCtx)
+	require.True(t, sessionLive(ctx))
+}
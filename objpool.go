@@ -2,42 +2,93 @@ package reqcache
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 // objectPool manages an array of objects of type T, preallocating memory for them.
 type objectPool[T any] struct {
-	mu    sync.Mutex
-	data  []T
-	index int
+	mu       sync.Mutex
+	data     []T
+	index    int
+	overflow int // number of objects allocated after the array was exhausted
 
-	name   string
-	logger ILogger
+	overflowPool    *sync.Pool // source of the objects after the array was exhausted, nil to allocate them
+	overflowObjects []*T       // objects taken from overflowPool
+
+	logger          *loggerHolder
+	onFirstOverflow func(ctx context.Context, name string, sessionID uint64) // set by WithOnFirstOverflow
+	budget          int                                                      // set by WithObjectBudget, 0 if unlimited
 }
 
 // newObjectPool creates a new objectPool.
-func newObjectPool[T any](name string, size int, logger ILogger) *objectPool[T] {
+func newObjectPool[T any](size int, logger *loggerHolder) *objectPool[T] {
 	return &objectPool[T]{
-		mu:     sync.Mutex{},
-		data:   make([]T, size),
-		index:  0,
-		name:   name,
-		logger: logger,
+		mu:       sync.Mutex{},
+		data:     make([]T, size),
+		index:    0,
+		overflow: 0,
+
+		overflowPool:    nil,
+		overflowObjects: nil,
+
+		logger:          logger,
+		onFirstOverflow: nil,
+		budget:          0,
 	}
 }
 
 // get returns a pointer to a new object of type T from the array.
+// Returns nil if the budget set by WithObjectBudget is exhausted.
 func (p *objectPool[T]) get(ctx context.Context) *T {
-	var hit bool
-	if p.logger != nil {
-		defer func() { p.logger.LogObjectPoolHitRatio(ctx, p.name, hit) }()
+	var hit, overBudget bool
+	if name, loggers := p.logger.getPerCall(ctx); loggers[0] != nil || loggers[1] != nil {
+		defer func() {
+			if overBudget {
+				return
+			}
+			for _, logger := range loggers {
+				if logger != nil {
+					logger.LogObjectPoolHitRatio(ctx, name, hit)
+				}
+			}
+		}()
+	}
+
+	var firstOverflow bool
+	if p.onFirstOverflow != nil {
+		// called after unlocking, so the callback may use the cache
+		defer func() {
+			if firstOverflow {
+				p.onFirstOverflow(ctx, p.logger.nameFor(ctx), fromContext(ctx))
+			}
+		}()
 	}
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.budget > 0 && p.index+p.overflow >= p.budget {
+		overBudget = true
+		return nil
+	}
+
 	if p.index >= len(p.data) {
-		return new(T)
+		p.overflow++
+		firstOverflow = p.overflow == 1
+
+		if p.overflowPool == nil {
+			return new(T)
+		}
+
+		obj, _ := p.overflowPool.Get().(*T)
+		var zero T
+		*obj = zero
+		p.overflowObjects = append(p.overflowObjects, obj)
+
+		return obj
 	}
 
 	res := &p.data[p.index]
@@ -47,36 +98,140 @@ func (p *objectPool[T]) get(ctx context.Context) *T {
 	return res
 }
 
+// warm writes to the unused objects of the array, so the memory backing them is faulted in.
+// The objects are already zeroed, so writing zero values doesn't change them.
+func (p *objectPool[T]) warm() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var zero T
+	for i := p.index; i < len(p.data); i++ {
+		p.data[i] = zero
+	}
+}
+
+// contains reports whether the object lies within the preallocated array.
+func (p *objectPool[T]) contains(obj *T) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.data) == 0 || obj == nil {
+		return false
+	}
+
+	// only the addresses are compared, they are never converted back to pointers
+	start := uintptr(unsafe.Pointer(&p.data[0]))
+	end := start + uintptr(len(p.data))*unsafe.Sizeof(p.data[0])
+	addr := uintptr(unsafe.Pointer(obj))
+
+	return addr >= start && addr < end
+}
+
+// usage returns the number of objects taken from the array and the number of objects allocated after it was exhausted.
+func (p *objectPool[T]) usage() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.index, p.overflow
+}
+
+// reset prepares the pool for the next session with an array of size objects.
+func (p *objectPool[T]) reset(size int) {
+	// index is the watermark of the previous usage: the objects after it were never handed out,
+	// so only the used prefix has to be zeroed. It matters for large T with low usage.
+	// The whole backing array stays zeroed, so it can be resliced to any size within its capacity.
+	var zero T
+	for i := 0; i < p.index; i++ {
+		p.data[i] = zero
+	}
+
+	if size <= cap(p.data) {
+		p.data = p.data[:size]
+	} else {
+		p.data = make([]T, size)
+	}
+
+	p.index = 0
+	p.overflow = 0
+}
+
+// checkInvariants returns an error if the state of the pool is inconsistent.
+func (p *objectPool[T]) checkInvariants() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.index < 0 || p.index > len(p.data):
+		return fmt.Errorf("index %d is out of bounds [0, %d]", p.index, len(p.data))
+	case p.overflow < 0:
+		return fmt.Errorf("negative overflow %d", p.overflow)
+	case p.overflow > 0 && p.index < len(p.data):
+		return fmt.Errorf("overflow %d while only %d of %d objects are used", p.overflow, p.index, len(p.data))
+	case p.overflowPool != nil && len(p.overflowObjects) != p.overflow:
+		return fmt.Errorf("%d recycled overflow objects, expected %d", len(p.overflowObjects), p.overflow)
+	}
+
+	return nil
+}
+
 // objectSyncPool is a wrapper around sync.Pool.
 type objectSyncPool[T any] struct {
-	pool *sync.Pool
+	allocs uint64 // number of object pools created because the pool was empty, accessed atomically
+
+	pool            *sync.Pool
+	overflow        *sync.Pool // recycles the objects allocated after the array was exhausted, nil if disabled
+	onFirstOverflow func(ctx context.Context, name string, sessionID uint64)
+	budget          int
 }
 
 // newObjectSyncPool creates a new objectSyncPool.
-func newObjectSyncPool[T any](name string, size int, logger ILogger) *objectSyncPool[T] {
-	return &objectSyncPool[T]{
-		pool: &sync.Pool{
-			New: func() any {
-				return newObjectPool[T](name, size, logger)
-			},
+func newObjectSyncPool[T any](size int, logger *loggerHolder) *objectSyncPool[T] {
+	w := &objectSyncPool[T]{
+		allocs:          0,
+		pool:            nil,
+		overflow:        nil,
+		onFirstOverflow: nil,
+		budget:          0,
+	}
+	w.pool = &sync.Pool{
+		New: func() any {
+			atomic.AddUint64(&w.allocs, 1)
+			return newObjectPool[T](size, logger)
 		},
 	}
+
+	return w
 }
 
-// Get returns an object from the pool.
-func (w *objectSyncPool[T]) Get() *objectPool[T] {
+// enableOverflowPool makes the object pools recycle the objects allocated after their arrays were exhausted.
+// Must be called before the first Get.
+func (w *objectSyncPool[T]) enableOverflowPool() {
+	w.overflow = &sync.Pool{
+		New: func() any {
+			return new(T)
+		},
+	}
+}
+
+// Get returns an object from the pool with an array of size objects.
+func (w *objectSyncPool[T]) Get(size int) *objectPool[T] {
 	o, _ := w.pool.Get().(*objectPool[T])
-	o.index = 0
 
-	var zero T
-	for i := 0; i < len(o.data); i++ {
-		o.data[i] = zero
-	}
+	o.reset(size)
+	o.overflowPool = w.overflow
+	o.onFirstOverflow = w.onFirstOverflow
+	o.budget = w.budget
 
 	return o
 }
 
 // Put puts an object in the pool.
 func (w *objectSyncPool[T]) Put(v *objectPool[T]) {
+	for i, obj := range v.overflowObjects {
+		w.overflow.Put(obj)
+		v.overflowObjects[i] = nil
+	}
+	v.overflowObjects = v.overflowObjects[:0]
+
 	w.pool.Put(v)
 }
@@ -11,13 +11,13 @@ import (
 func TestNewObjectPool(t *testing.T) {
 	t.Parallel()
 
-	pool := newObjectPool[int]("testPool", 10, nil)
+	pool := newObjectPool[int](10, newLoggerHolder("testPool", nil))
 
 	require.NotNil(t, pool, "New object pool should not be nil")
 	require.Len(t, pool.data, 10, "New object pool should have the correct size")
 	require.Equal(t, 0, pool.index, "New object pool should have an initial index of 0")
-	require.Equal(t, "testPool", pool.name, "New object pool should have the correct name")
-	require.Nil(t, pool.logger, "New object pool should have a nil logger")
+	require.Equal(t, "testPool", pool.logger.name, "New object pool should have the correct name")
+	require.Nil(t, pool.logger.logger, "New object pool should have a nil logger")
 }
 
 func TestObjectPoolGet(t *testing.T) {
@@ -25,7 +25,7 @@ func TestObjectPoolGet(t *testing.T) {
 
 	ctx := context.Background()
 
-	pool := newObjectPool[int]("testPool", 2, nil)
+	pool := newObjectPool[int](2, newLoggerHolder("testPool", nil))
 
 	require.Len(t, pool.data, 2, "Object pool should have 2 elements")
 
@@ -54,7 +54,7 @@ func TestObjectPoolOverflowLogging(t *testing.T) {
 	ctx := context.Background()
 
 	logger := &mockLogger{}
-	pool := newObjectPool[int]("testPool", 1, logger)
+	pool := newObjectPool[int](1, newLoggerHolder("testPool", logger))
 
 	// Fill the pool
 	pool.get(ctx)
@@ -73,9 +73,9 @@ func TestObjectSyncPoolReuse(t *testing.T) {
 	// Request an object from the sync pool
 	const objCount = 10
 
-	syncPool := newObjectSyncPool[int]("testSyncPool", objCount, nil)
+	syncPool := newObjectSyncPool[int](objCount, newLoggerHolder("testSyncPool", nil))
 
-	pool1 := syncPool.Get()
+	pool1 := syncPool.Get(objCount)
 	for i := 0; i < objCount; i++ {
 		obj := pool1.get(ctx)
 		*obj = i + 1
@@ -85,7 +85,7 @@ func TestObjectSyncPoolReuse(t *testing.T) {
 	syncPool.Put(pool1)
 
 	// Request another object pool, it should reuse the previous pool and not reallocate memory
-	pool2 := syncPool.Get()
+	pool2 := syncPool.Get(objCount)
 	require.Same(t, pool1, pool2, "Reused object pool should be the same as the previous pool")
 	require.Equal(t, 0, pool2.index, "Reused object pool should have an initial index of 0")
 	require.Len(t, pool2.data, objCount, "Reused object pool should have the correct size")
@@ -96,3 +96,188 @@ func TestObjectSyncPoolReuse(t *testing.T) {
 		require.Equal(t, 0, *obj, "Object should be cleared")
 	}
 }
+
+func TestObjectPoolWarm(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pool := newObjectPool[int](3, newLoggerHolder("testPool", nil))
+	*pool.get(ctx) = 1
+
+	pool.warm()
+	require.Equal(t, 1, pool.index, "Warming should not take objects from the pool")
+	require.Equal(t, []int{1, 0, 0}, pool.data, "Warming should not change the objects in use")
+}
+
+func TestObjectPoolOnFirstOverflow(t *testing.T) {
+	t.Parallel()
+
+	var calls []uint64
+	cache := New[string, int](1, 0, WithLogger("test", nil),
+		WithOnFirstOverflow(func(_ context.Context, name string, sessionID uint64) {
+			require.Equal(t, "test", name)
+			calls = append(calls, sessionID)
+		}))
+
+	ctx := NewSession(context.Background())
+	for i := 0; i < 3; i++ {
+		cache.NewObject(ctx)
+	}
+	require.NoError(t, cache.EndSession(ctx))
+
+	id, err := SessionID(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{id}, calls, "The callback must be called once per session")
+
+	// Reused pools report the overflow of the next session again
+	ctx = NewSession(context.Background())
+	for i := 0; i < 3; i++ {
+		cache.NewObject(ctx)
+	}
+	require.NoError(t, cache.EndSession(ctx))
+	require.Len(t, calls, 2)
+}
+
+func TestObjectPoolUsage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	syncPool := newObjectSyncPool[int](2, newLoggerHolder("testSyncPool", nil))
+	pool := syncPool.Get(2)
+
+	for i := 0; i < 5; i++ {
+		pool.get(ctx)
+	}
+
+	used, overflow := pool.usage()
+	require.Equal(t, 2, used, "All pre-allocated objects should be used")
+	require.Equal(t, 3, overflow, "Objects beyond the capacity should be counted as overflow")
+
+	// Usage is reset when the pool is reused
+	syncPool.Put(pool)
+	pool = syncPool.Get(2)
+
+	used, overflow = pool.usage()
+	require.Zero(t, used)
+	require.Zero(t, overflow)
+}
+
+func TestObjectSyncPoolPartialReuse(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	syncPool := newObjectSyncPool[int](10, newLoggerHolder("testSyncPool", nil))
+
+	pool1 := syncPool.Get(10)
+	for i := 0; i < 3; i++ {
+		*pool1.get(ctx) = i + 1
+	}
+	syncPool.Put(pool1)
+
+	pool2 := syncPool.Get(10)
+	require.Equal(t, 0, pool2.index, "Reused object pool should have an initial index of 0")
+	for i := 0; i < len(pool2.data); i++ {
+		require.Equal(t, 0, *pool2.get(ctx), "Object should be cleared")
+	}
+}
+
+func TestObjectSyncPoolOverflowPool(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	syncPool := newObjectSyncPool[int](1, newLoggerHolder("testSyncPool", nil))
+	syncPool.enableOverflowPool()
+
+	pool := syncPool.Get(1)
+	*pool.get(ctx) = 1
+	for i := 0; i < 3; i++ {
+		*pool.get(ctx) = i + 2
+	}
+	require.Len(t, pool.overflowObjects, 3, "Overflow objects should be tracked")
+
+	syncPool.Put(pool)
+	require.Empty(t, pool.overflowObjects, "Overflow objects should be returned")
+
+	// Recycled overflow objects are cleared
+	pool = syncPool.Get(1)
+	pool.get(ctx)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, 0, *pool.get(ctx), "Object should be cleared")
+	}
+
+	used, overflow := pool.usage()
+	require.Equal(t, 1, used)
+	require.Equal(t, 3, overflow)
+}
+
+func TestReqCache_ObjectBudget(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, int](2, 0, WithObjectBudget(3))
+
+	_, err := cache.TryNewObject(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	for i := 0; i < 3; i++ { // the budget includes the overflow objects
+		obj, err := cache.TryNewObject(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, obj)
+	}
+
+	_, err = cache.TryNewObject(ctx)
+	require.ErrorIs(t, err, ErrObjectBudgetExceeded)
+	require.PanicsWithValue(t, ErrObjectBudgetExceeded, func() { cache.NewObject(ctx) })
+	require.NoError(t, cache.EndSession(ctx))
+
+	// The budget is per session
+	ctx = NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for i := 0; i < 3; i++ {
+		require.NotNil(t, cache.NewObject(ctx))
+	}
+	_, err = cache.TryNewObject(ctx)
+	require.ErrorIs(t, err, ErrObjectBudgetExceeded)
+}
+
+func TestObjectPoolReset(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pool := newObjectPool[int](4, newLoggerHolder("testPool", nil))
+	for i := 0; i < 5; i++ {
+		pool.get(ctx)
+	}
+	for i := range pool.data {
+		pool.data[i] = i + 1
+	}
+	backing := &pool.data[0]
+
+	// A smaller size reslices the array without reallocation
+	pool.reset(2)
+	require.Len(t, pool.data, 2)
+	require.Same(t, backing, &pool.data[0], "The array must be reused")
+	require.Equal(t, []int{0, 0}, pool.data)
+	used, overflow := pool.usage()
+	require.Zero(t, used)
+	require.Zero(t, overflow)
+	*pool.get(ctx) = 1
+
+	// Growing within the capacity exposes only zeroed objects
+	pool.reset(4)
+	require.Same(t, backing, &pool.data[0], "The array must be reused")
+	require.Equal(t, []int{0, 0, 0, 0}, pool.data)
+
+	// A larger size reallocates the array
+	pool.reset(8)
+	require.Len(t, pool.data, 8)
+	require.NotSame(t, backing, &pool.data[0])
+	require.Equal(t, make([]int, 8), pool.data)
+	require.NoError(t, pool.checkInvariants())
+}
@@ -0,0 +1,116 @@
+package reqcache
+
+import (
+	"context"
+	"fmt"
+)
+
+// OperationKind is the kind of a cache operation recorded by WithOperationRecording.
+type OperationKind int
+
+const (
+	// OperationPut is a Put call.
+	OperationPut OperationKind = iota
+	// OperationGet is a Get call, including the calls made by GetOrFetch and similar methods.
+	OperationGet
+	// OperationDelete is a Delete call.
+	OperationDelete
+)
+
+// String implements fmt.Stringer.
+func (k OperationKind) String() string {
+	switch k {
+	case OperationPut:
+		return "put"
+	case OperationGet:
+		return "get"
+	case OperationDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("OperationKind(%d)", int(k))
+	}
+}
+
+// Operation is a cache operation recorded by WithOperationRecording.
+type Operation[K comparable, T any] struct {
+	Kind OperationKind
+	// Key is the key passed to the operation.
+	Key K
+	// Value is the value stored by Put or returned by Get.
+	Value *T
+	// Found reports whether Get found the data or Delete removed it. It is false for Put.
+	Found bool
+}
+
+// WithOperationRecording makes the cache record the Put, Get and Delete calls of each session, so they can be
+// retrieved by OperationLog and replayed by Replay to reproduce a bug. The log grows with every call
+// and is kept until the end of the session, so the option is intended for debugging.
+func WithOperationRecording() Option {
+	return func(c *options) {
+		c.operationRecording = true
+	}
+}
+
+// OperationLog returns the operations of the session recorded since its start, in the order of execution.
+// Returns nil if WithOperationRecording isn't set.
+func (m *ReqCache[K, T]) OperationLog(ctx context.Context) ([]Operation[K, T], error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok := m.lookupSession(requestKey)
+
+	if !ok {
+		return nil, nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.extra == nil {
+		return nil, nil
+	}
+
+	return append([]Operation[K, T](nil), state.extra.operations...), nil
+}
+
+// Replay executes the recorded operations in the session of the context, usually against a fresh cache.
+// Returns an error wrapping ErrReplayDiverged at the first Get or Delete whose result differs from the recorded one.
+func Replay[K comparable, T any](ctx context.Context, c *ReqCache[K, T], ops []Operation[K, T]) error {
+	for i, op := range ops {
+		var found bool
+
+		switch op.Kind {
+		case OperationPut:
+			if err := c.Put(ctx, op.Key, op.Value); err != nil {
+				return fmt.Errorf("operation %d (%s %s): %w", i, op.Kind, keyString(op.Key), err)
+			}
+			continue
+		case OperationGet:
+			_, found = c.Get(ctx, op.Key)
+		case OperationDelete:
+			found = c.Delete(ctx, op.Key)
+		default:
+			return fmt.Errorf("operation %d: unknown kind %s", i, op.Kind)
+		}
+
+		if found != op.Found {
+			return fmt.Errorf("%w: operation %d (%s %s): found %v, recorded %v",
+				ErrReplayDiverged, i, op.Kind, keyString(op.Key), found, op.Found)
+		}
+	}
+
+	return nil
+}
+
+// recordOperation appends the operation to the session's log.
+func (m *ReqCache[K, T]) recordOperation(ctx context.Context, op Operation[K, T]) {
+	state := m.trackSession(ctx, fromContext(ctx))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	x := state.extras()
+	x.operations = append(x.operations, op)
+}
@@ -0,0 +1,64 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_OperationRecording(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10, WithOperationRecording())
+
+	_, err := cache.OperationLog(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	obj := &reqCacheTestObject{value: 1}
+	cache.Get(ctx, "key")
+	require.NoError(t, cache.Put(ctx, "key", obj))
+	cache.Get(ctx, "key")
+	cache.Delete(ctx, "key")
+	cache.Delete(ctx, "key")
+
+	ops, err := cache.OperationLog(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Operation[string, reqCacheTestObject]{
+		{Kind: OperationGet, Key: "key", Value: nil, Found: false},
+		{Kind: OperationPut, Key: "key", Value: obj, Found: false},
+		{Kind: OperationGet, Key: "key", Value: obj, Found: true},
+		{Kind: OperationDelete, Key: "key", Value: nil, Found: true},
+		{Kind: OperationDelete, Key: "key", Value: nil, Found: false},
+	}, ops)
+
+	// The log is reproduced by a fresh cache
+	fresh := New[string, reqCacheTestObject](0, 10)
+	freshCtx := NewSession(context.Background())
+	defer fresh.EndSession(freshCtx)
+	require.NoError(t, Replay(freshCtx, fresh, ops))
+
+	// A cache in another state diverges
+	require.NoError(t, fresh.Put(freshCtx, "key", obj))
+	err = Replay(freshCtx, fresh, ops)
+	require.ErrorIs(t, err, ErrReplayDiverged)
+	require.Contains(t, err.Error(), "operation 0 (get key)")
+}
+
+func TestReqCache_OperationRecordingDisabled(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{}))
+
+	ops, err := cache.OperationLog(ctx)
+	require.NoError(t, err)
+	require.Empty(t, ops)
+}
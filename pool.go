@@ -0,0 +1,37 @@
+package reqcache
+
+import "context"
+
+// ObjectPool is a wrapper around ReqCache used only for allocating objects from the preallocated memory,
+// without caching and keys.
+type ObjectPool[T any] struct {
+	cache *ReqCache[struct{}, T]
+}
+
+// NewPoolOnly creates a new instance of ObjectPool.
+// objSize is the size of the array of objects of type T, preallocating memory for them.
+// Panics if objSize is not positive. The options related to caching have no effect.
+func NewPoolOnly[T any](objSize int, opts ...Option) *ObjectPool[T] {
+	if objSize <= 0 {
+		panic("object pool size must be greater than 0")
+	}
+
+	return &ObjectPool[T]{
+		cache: New[struct{}, T](objSize, 0, opts...),
+	}
+}
+
+// NewObject creates a new object of type T. See ReqCache.NewObject.
+func (p *ObjectPool[T]) NewObject(ctx context.Context) *T {
+	return p.cache.NewObject(ctx)
+}
+
+// Warm pre-faults the memory of the session's preallocated objects. See ReqCache.Warm.
+func (p *ObjectPool[T]) Warm(ctx context.Context) error {
+	return p.cache.Warm(ctx)
+}
+
+// EndSession returns the session's objects to the pool. See ReqCache.EndSession.
+func (p *ObjectPool[T]) EndSession(ctx context.Context) error {
+	return p.cache.EndSession(ctx)
+}
@@ -0,0 +1,32 @@
+//nolint:exhaustruct // tests
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPoolOnly(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() { NewPoolOnly[reqCacheTestObject](0) })
+
+	pool := NewPoolOnly[reqCacheTestObject](2)
+
+	ctx := NewSession(context.Background())
+
+	obj1 := pool.NewObject(ctx)
+	obj2 := pool.NewObject(ctx)
+	obj3 := pool.NewObject(ctx)
+
+	p, _ := pool.cache.sessionObjectsIfAny(fromContext(ctx))
+	require.Same(t, &p.data[0], obj1)
+	require.Same(t, &p.data[1], obj2)
+	require.NotNil(t, obj3)
+
+	stats, err := pool.cache.EndSessionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, EndStats{Entries: 0, PooledObjectsUsed: 2, OverflowObjects: 1}, stats)
+}
@@ -0,0 +1,98 @@
+package reqcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// PoolDiag contains statistics of the pre-allocated object memory usage collected by ended sessions.
+type PoolDiag struct {
+	// Reuses is the number of sessions whose objects fit into the pre-allocated memory.
+	Reuses uint64
+	// Overflows is the number of sessions that exhausted the pre-allocated memory and allocated extra objects.
+	Overflows uint64
+	// AverageUsage is the average number of objects created by NewObject per session.
+	// If it is regularly above objSize, objSize should be increased.
+	AverageUsage float64
+}
+
+// poolCounters contains the counters for PoolDiagnostics. It is accessed atomically.
+type poolCounters struct {
+	reuses    uint64
+	overflows uint64
+	objects   uint64
+}
+
+// record counts a session which took used objects from the pre-allocated memory and allocated overflow objects.
+func (c *poolCounters) record(used, overflow int) {
+	if overflow > 0 {
+		atomic.AddUint64(&c.overflows, 1)
+	} else {
+		atomic.AddUint64(&c.reuses, 1)
+	}
+
+	atomic.AddUint64(&c.objects, uint64(used+overflow))
+}
+
+// PoolDiagnostics returns statistics of the pre-allocated object memory usage
+// for all sessions that created objects since the cache creation or the last ResetPoolDiagnostics call.
+func (m *ReqCache[K, T]) PoolDiagnostics() PoolDiag {
+	reuses := atomic.LoadUint64(&m.poolStats.reuses)
+	overflows := atomic.LoadUint64(&m.poolStats.overflows)
+	objects := atomic.LoadUint64(&m.poolStats.objects)
+
+	var average float64
+	if sessions := reuses + overflows; sessions > 0 {
+		average = float64(objects) / float64(sessions)
+	}
+
+	return PoolDiag{
+		Reuses:       reuses,
+		Overflows:    overflows,
+		AverageUsage: average,
+	}
+}
+
+// ResetPoolDiagnostics resets the statistics returned by PoolDiagnostics.
+// It is intended for tests.
+func (m *ReqCache[K, T]) ResetPoolDiagnostics() {
+	atomic.StoreUint64(&m.poolStats.reuses, 0)
+	atomic.StoreUint64(&m.poolStats.overflows, 0)
+	atomic.StoreUint64(&m.poolStats.objects, 0)
+}
+
+// PoolMissCount returns the number of session storages and object pools that were allocated because
+// their sync.Pool was empty, since the cache creation or the last ResetPoolMissCount call.
+// The pools are drained by the garbage collector, so frequent misses mean that the GC pressure defeats pooling.
+func (m *ReqCache[K, T]) PoolMissCount() (uint64, uint64) {
+	return atomic.LoadUint64(&m.dataPool.allocs), atomic.LoadUint64(&m.objectsPool.allocs)
+}
+
+// ResetPoolMissCount resets the counters returned by PoolMissCount.
+// It is intended for tests.
+func (m *ReqCache[K, T]) ResetPoolMissCount() {
+	atomic.StoreUint64(&m.dataPool.allocs, 0)
+	atomic.StoreUint64(&m.objectsPool.allocs, 0)
+}
+
+// IsPooled reports whether the data cached for the key lies within the session's preallocated object memory,
+// i.e. was created by NewObject before the memory was exhausted, as opposed to an allocation on the heap.
+// The second return value is false if there is no data for the key. The recency of the data is not updated.
+// It is intended for debugging the memory usage.
+func (m *ReqCache[K, T]) IsPooled(ctx context.Context, dataKey K) (bool, bool, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return false, false, err
+	}
+
+	obj, found := m.peek(ctx, requestKey, dataKey)
+	if !found {
+		return false, false, nil
+	}
+
+	p, ok := m.sessionObjectsIfAny(requestKey)
+
+	return ok && p.contains(obj), true, nil
+}
@@ -0,0 +1,116 @@
+package reqcache
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_PoolDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](2, 1)
+	require.Equal(t, PoolDiag{}, cache.PoolDiagnostics())
+
+	// Two sessions fit into the pre-allocated memory
+	for _, n := range []int{1, 2} {
+		ctx := NewSession(context.Background())
+		for i := 0; i < n; i++ {
+			cache.NewObject(ctx)
+		}
+		require.NoError(t, cache.EndSession(ctx))
+	}
+
+	// One session overflows
+	ctx := NewSession(context.Background())
+	for i := 0; i < 5; i++ {
+		cache.NewObject(ctx)
+	}
+	require.NoError(t, cache.EndSession(ctx))
+
+	// Sessions without objects are not counted
+	require.NoError(t, cache.EndSession(NewSession(context.Background())))
+
+	require.Equal(t, PoolDiag{Reuses: 2, Overflows: 1, AverageUsage: 8.0 / 3.0}, cache.PoolDiagnostics())
+
+	cache.ResetPoolDiagnostics()
+	require.Equal(t, PoolDiag{}, cache.PoolDiagnostics())
+}
+
+func TestReqCache_IsPooled(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](1, 10)
+
+	_, _, err := cache.IsPooled(context.Background(), "key")
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// No object pool in the session yet
+	require.NoError(t, cache.Put(ctx, "heap", &reqCacheTestObject{}))
+	pooled, found, err := cache.IsPooled(ctx, "heap")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.False(t, pooled)
+
+	prepare := func(context.Context, *reqCacheTestObject) error { return nil }
+
+	_, err = cache.GetOrNew(ctx, "pooled", prepare)
+	require.NoError(t, err)
+	pooled, found, err = cache.IsPooled(ctx, "pooled")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.True(t, pooled)
+
+	// The pool is exhausted, the object is allocated on the heap
+	_, err = cache.GetOrNew(ctx, "overflow", prepare)
+	require.NoError(t, err)
+	pooled, found, err = cache.IsPooled(ctx, "overflow")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.False(t, pooled)
+
+	pooled, found, err = cache.IsPooled(ctx, "heap")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.False(t, pooled)
+
+	_, found, err = cache.IsPooled(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+// Not parallel: forcing GC would drain the pools of the parallel tests relying on reuse.
+func TestReqCache_PoolMissCount(t *testing.T) {
+
+	cache := New[string, reqCacheTestObject](10, 10)
+
+	useSession := func() {
+		ctx := NewSession(context.Background())
+		require.NoError(t, cache.Put(ctx, "key", cache.NewObject(ctx)))
+		require.NoError(t, cache.EndSession(ctx))
+	}
+
+	useSession()
+	cacheMisses, objectMisses := cache.PoolMissCount()
+	require.EqualValues(t, 1, cacheMisses, "The first session allocates the storage")
+	require.EqualValues(t, 1, objectMisses, "The first session allocates the object pool")
+
+	// Two collections drain sync.Pool completely, including its victim cache
+	runtime.GC()
+	runtime.GC()
+
+	useSession()
+	newCacheMisses, newObjectMisses := cache.PoolMissCount()
+	require.Greater(t, newCacheMisses, cacheMisses)
+	require.Greater(t, newObjectMisses, objectMisses)
+
+	cache.ResetPoolMissCount()
+	cacheMisses, objectMisses = cache.PoolMissCount()
+	require.Zero(t, cacheMisses)
+	require.Zero(t, objectMisses)
+}
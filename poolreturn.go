@@ -0,0 +1,103 @@
+package reqcache
+
+import "sync"
+
+// WithBatchedPoolReturns makes EndSession hand the session's storage and object pool to a background goroutine,
+// which returns them to the pools in bursts, instead of returning them itself. It reduces the work done by
+// EndSession and the contention of the pools under very high session churn. The goroutine runs only while
+// there are pools to return, so they become available for reuse almost immediately.
+func WithBatchedPoolReturns() Option {
+	return func(c *options) {
+		c.batchedPoolReturns = true
+	}
+}
+
+// poolReturner returns the storages and object pools of ended sessions to the pools from a background goroutine.
+type poolReturner[K comparable, T any] struct {
+	data    *cachePool[K, T]
+	objects *objectSyncPool[T]
+
+	mu             sync.Mutex
+	pendingData    []*sessionData[K, T]
+	pendingObjects []*objectPool[T]
+	running        bool // the goroutine returning the pending pools is running
+}
+
+// newPoolReturner creates a new poolReturner.
+func newPoolReturner[K comparable, T any](data *cachePool[K, T], objects *objectSyncPool[T]) *poolReturner[K, T] {
+	return &poolReturner[K, T]{
+		data:           data,
+		objects:        objects,
+		mu:             sync.Mutex{},
+		pendingData:    nil,
+		pendingObjects: nil,
+		running:        false,
+	}
+}
+
+// putData schedules returning the session entry with its storage to the pool.
+func (r *poolReturner[K, T]) putData(d *sessionData[K, T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pendingData = append(r.pendingData, d)
+	r.start()
+}
+
+// putObjects schedules returning the object pool to the pool.
+func (r *poolReturner[K, T]) putObjects(p *objectPool[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pendingObjects = append(r.pendingObjects, p)
+	r.start()
+}
+
+// start starts the goroutine returning the pending pools if it isn't running. Must be called under the lock.
+func (r *poolReturner[K, T]) start() {
+	if r.running {
+		return
+	}
+
+	r.running = true
+	go r.run()
+}
+
+// run returns the pending pools until there are none left.
+func (r *poolReturner[K, T]) run() {
+	var (
+		data    []*sessionData[K, T]
+		objects []*objectPool[T]
+	)
+
+	for {
+		r.mu.Lock()
+		if len(r.pendingData) == 0 && len(r.pendingObjects) == 0 {
+			r.running = false
+			r.mu.Unlock()
+			return
+		}
+		// swap the buffers, so new pools are collected while the current burst is returned
+		data, r.pendingData = r.pendingData, data[:0]
+		objects, r.pendingObjects = r.pendingObjects, objects[:0]
+		r.mu.Unlock()
+
+		for i, d := range data {
+			r.data.Put(d)
+			data[i] = nil
+		}
+
+		for i, p := range objects {
+			r.objects.Put(p)
+			objects[i] = nil
+		}
+	}
+}
+
+// idle reports whether there are no pools waiting to be returned.
+func (r *poolReturner[K, T]) idle() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !r.running
+}
@@ -0,0 +1,40 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_BatchedPoolReturns(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](10, 10, WithBatchedPoolReturns())
+
+	ctx := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{value: 1}))
+	*cache.NewObject(ctx) = reqCacheTestObject{value: 2}
+	prev, _ := cache.sessionObjectsIfAny(fromContext(ctx))
+	require.NoError(t, cache.EndSession(ctx))
+
+	require.Eventually(t, cache.poolReturner.idle, time.Second, time.Millisecond)
+
+	// sync.Pool may drop objects (it always does so randomly under the race detector), so several attempts are made
+	reused := false
+	for i := 0; i < 20 && !reused; i++ {
+		ctx = NewSession(context.Background())
+		obj := cache.NewObject(ctx)
+		require.Zero(t, *obj, "Reused object must be cleared")
+		require.False(t, cache.Exists(ctx, "key"), "Reused storage must be purged")
+
+		p, _ := cache.sessionObjectsIfAny(fromContext(ctx))
+		reused = p == prev
+		prev = p
+
+		require.NoError(t, cache.EndSession(ctx))
+		require.Eventually(t, cache.poolReturner.idle, time.Second, time.Millisecond)
+	}
+	require.True(t, reused, "Returned object pools must be reused")
+}
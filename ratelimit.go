@@ -0,0 +1,39 @@
+package reqcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// warningInterval is the minimal interval between two warnings of the same kind.
+const warningInterval = time.Second
+
+// rateLimiter allows an event at most once per interval.
+type rateLimiter struct {
+	interval time.Duration
+	last     int64 // unix nanoseconds of the last allowed event, 0 if there was none
+}
+
+// newRateLimiter creates a new rateLimiter.
+func newRateLimiter(interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		interval: interval,
+		last:     0,
+	}
+}
+
+// allow reports whether an event that happened at the given time may be processed.
+func (l *rateLimiter) allow(now time.Time) bool {
+	nowNano := now.UnixNano()
+
+	for {
+		last := atomic.LoadInt64(&l.last)
+		if last != 0 && nowNano-last < int64(l.interval) {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&l.last, last, nowNano) {
+			return true
+		}
+	}
+}
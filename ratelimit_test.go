@@ -0,0 +1,19 @@
+package reqcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	l := newRateLimiter(time.Second)
+	now := time.Now()
+
+	require.True(t, l.allow(now), "first event should be allowed")
+	require.False(t, l.allow(now.Add(time.Millisecond)), "event within the interval should be suppressed")
+	require.True(t, l.allow(now.Add(time.Second)), "event after the interval should be allowed")
+}
@@ -2,10 +2,14 @@ package reqcache
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
-
-	lru "github.com/hashicorp/golang-lru/v2"
+	"time"
 )
 
 // ILogger is an interface for logging new object pool overflows and cache hit/miss ratio.
@@ -14,6 +18,52 @@ type ILogger interface {
 	LogCacheHitRatio(ctx context.Context, name string, hit bool)
 }
 
+// ISessionLeakLogger is an optional extension of ILogger for reporting a suspiciously large number of live sessions.
+// It is used together with WithLeakThreshold.
+type ISessionLeakLogger interface {
+	LogSessionLeakWarning(ctx context.Context, name string, live int)
+}
+
+// ISlowFetchLogger is an optional extension of ILogger for reporting slow fetchers.
+// It is used together with WithSlowFetchThreshold.
+type ISlowFetchLogger interface {
+	LogSlowFetch(ctx context.Context, name string, key string, took time.Duration)
+}
+
+// IEvictionLogger is an optional extension of ILogger for reporting entries evicted from the session's cache
+// because it reached cacheSize. Frequent evictions mean that cacheSize is too small for the request.
+// To limit the volume, not more than one eviction per second is reported.
+type IEvictionLogger interface {
+	LogCacheEviction(ctx context.Context, name string, evictedKey string)
+}
+
+// IFetchLogger is an optional extension of ILogger for measuring every fetcher call made by GetOrFetch and similar
+// methods. The key is converted to a string like for ISlowFetchLogger.
+type IFetchLogger interface {
+	LogFetch(ctx context.Context, name string, key string, took time.Duration, err error)
+}
+
+// ISessionLogger is an optional extension of ILogger for tracking the sessions that use the cache.
+// A session is reported as started when it first uses the cache (for example, puts data or creates an object)
+// and as ended by EndSession. Sessions that didn't use the cache are not reported.
+type ISessionLogger interface {
+	LogSessionStart(ctx context.Context, name string)
+	LogSessionEnd(ctx context.Context, name string, stats EndStats)
+}
+
+// IKeySizeLogger is an optional extension of ILogger for reporting keys larger than the limit set by
+// WithKeySizeWarning. To limit the volume, not more than one key per second is reported.
+type IKeySizeLogger interface {
+	LogOversizedKey(ctx context.Context, name string, key string, size int)
+}
+
+// ISessionEntriesObserver is an optional extension of ILogger for building the distribution of the number of entries
+// cached by the sessions, for example, as a histogram. It helps to choose cacheSize fitting most requests.
+// The number is observed by EndSession for the sessions reported to ISessionLogger.
+type ISessionEntriesObserver interface {
+	ObserveSessionEntries(ctx context.Context, name string, count int)
+}
+
 // NewSession adds a unique key for caching data in the cache.
 // Must be called once at the beginning of the request processing.
 func NewSession(ctx context.Context) context.Context {
@@ -21,7 +71,94 @@ func NewSession(ctx context.Context) context.Context {
 		panic("context already has a reqcache key")
 	}
 
-	return context.WithValue(ctx, contextKey, atomic.AddUint64(&requestID, 1))
+	return newSession(ctx, "", "", -1)
+}
+
+// NewSessionNamespaced works like NewSession, but binds the session to the namespace (for example, a tenant).
+// Session ids are unique across all namespaces, so the data of sessions from different namespaces never overlaps.
+// Returns an error instead of panicking if the context already has a session.
+func NewSessionNamespaced(ctx context.Context, namespace string) (context.Context, error) {
+	if namespace == "" {
+		return nil, ErrEmptyNamespace
+	}
+
+	if InContext(ctx) {
+		return nil, ErrSessionAlreadyStarted
+	}
+
+	return newSession(ctx, namespace, "", -1), nil
+}
+
+// NewSessionNamed works like NewSession, but names the session after the operation it serves.
+// Loggers receive the operation name instead of the cache name for everything done within the session,
+// so the metrics of one cache can be broken down by operations. An empty name means the cache name.
+// Returns an error instead of panicking if the context already has a session.
+func NewSessionNamed(ctx context.Context, opName string) (context.Context, error) {
+	if InContext(ctx) {
+		return nil, ErrSessionAlreadyStarted
+	}
+
+	return newSession(ctx, "", opName, -1), nil
+}
+
+// NewSessionSized works like NewSession, but preallocates objSize objects for NewObject of the session
+// instead of the objSize of the cache, e.g. the known number of objects of the request.
+// The memory is reused across sessions: it is resliced if it's large enough and reallocated otherwise.
+// Returns an error instead of panicking if the context already has a session.
+func NewSessionSized(ctx context.Context, objSize int) (context.Context, error) {
+	if objSize < 0 {
+		return nil, ErrNegativeObjectSize
+	}
+
+	if InContext(ctx) {
+		return nil, ErrSessionAlreadyStarted
+	}
+
+	return newSession(ctx, "", "", objSize), nil
+}
+
+// SessionNamespace returns the namespace of the session set by NewSessionNamespaced.
+// Returns an empty string if the session has no namespace or there is no session in the context.
+func SessionNamespace(ctx context.Context) string {
+	if c := sessionOf(ctx); c != nil && c.session.names != nil {
+		return c.session.names.namespace
+	}
+
+	return ""
+}
+
+// newSession adds a new session to the context.
+func newSession(ctx context.Context, namespace, opName string, objSize int) context.Context {
+	id := atomic.AddUint64(&requestID, 1)
+
+	var names *sessionNames
+	if namespace != "" || opName != "" {
+		names = &sessionNames{namespace: namespace, opName: opName}
+	}
+
+	c := &sessionContext{
+		Context: ctx,
+		session: nil,
+		owner:   id,
+		own:     sessionValue{id: id, live: 1, objSize: objSize, names: names},
+	}
+	c.session = &c.own
+	startLiveSession(id, &c.own.live)
+
+	return c
+}
+
+// ShareSession returns a context with the same session, but with a different owner token.
+// Such contexts are intended to be passed to other goroutines working with the session.
+// If the cache is created with WithOwnerCheck, they can't end the session.
+func ShareSession(ctx context.Context) (context.Context, error) {
+	c := sessionOf(ctx)
+	if c == nil {
+		return nil, ErrNoSessionInContext
+	}
+
+	//nolint:exhaustruct // own is used only by the context returned by NewSession
+	return &sessionContext{Context: ctx, session: c.session, owner: atomic.AddUint64(&requestID, 1)}, nil
 }
 
 // InContext checks if there is a key for caching data in the cache.
@@ -32,19 +169,43 @@ func InContext(ctx context.Context) bool {
 
 // ReqCache is a structure for caching data within a single request.
 type ReqCache[K comparable, T any] struct {
-	op options
+	// accessed atomically, placed first for 64-bit alignment
+	lookups      lookupCounters // lookups of all sessions, for HitRatio and LifetimeStats
+	liveSessions int64          // number of registered sessions, see registerSession
+	poolStats    poolCounters
+	lifetime     lifetimeCounters
+
+	hasSnapshots     uint32 // set to 1 by the first WithReadSnapshot call, accessed atomically
+	expiringSessions int32  // number of sessions with expiration times of their entries, accessed atomically
+
+	op     options
+	logger *loggerHolder
 
 	cacheSize int
 	objSize   int
 
-	data     map[uint64]*lru.Cache[K, *T]
-	dataPool *cachePool[K, T]
+	dataShards   []*dataShard[K, T] // storages of the sessions, see dataShard
+	lockFreeData *sync.Map          // copy of the storages for lock-free reads, nil unless WithLockFreeSessionMap is set
+	dataPool     *cachePool[K, T]
+
+	objectShards []*objectShard[T] // object pools of the sessions, see objectShard
+	objectsPool  *objectSyncPool[T]
 
-	objects     map[uint64]*objectPool[T]
-	objectsPool *objectSyncPool[T]
+	poolReturner *poolReturner[K, T] // set by WithBatchedPoolReturns
 
-	muData    sync.RWMutex
-	muObjects sync.Mutex
+	fetchKeyNormalizer func(K) K
+	contextKey         func(context.Context, K) K
+	valueFinalizer     func(*T)
+	evictCallback      func(context.Context, K, *T)
+	keySizeOf          func(K) int // set by WithKeySizeWarning
+	excludedKeyFields  []int       // set by WithStructKeyNormalization, nil if no fields are excluded
+	expvars            *expvarCounters
+
+	sessionShards    []*sessionShard[K, T] // states of the sessions using the cache, see sessionShard
+	scratchPool      *sync.Pool            // buffers of ScratchBuffer released by ended sessions
+	leakWarnings     *rateLimiter
+	keySizeWarnings  *rateLimiter
+	evictionWarnings *rateLimiter
 }
 
 // WithLogger sets a logger for displaying/metrics new object pool overflows.
@@ -56,214 +217,2107 @@ func WithLogger(name string, logger ILogger) Option {
 	}
 }
 
-// New creates a new instance of ReqCache.
-// objSize is the size of the array of objects of type T, preallocating memory for them.
-// cacheSize is the size of the cache in a single request.
-func New[K comparable, T any](objSize, cacheSize int, opts ...Option) *ReqCache[K, T] {
-	m := &ReqCache[K, T]{
-		op:          options{}, //nolint:exhaustruct // default values
-		cacheSize:   cacheSize,
-		objSize:     objSize,
-		objectsPool: nil,
-		dataPool:    newPoolWrapper[K, T](cacheSize),
-		objects:     make(map[uint64]*objectPool[T]),
-		data:        make(map[uint64]*lru.Cache[K, *T]),
-		muData:      sync.RWMutex{},
-		muObjects:   sync.Mutex{},
+// WithMetricsLogger sets a logger exporting the metrics of the cache, such as reqcacheprom.Collector.
+// It is notified in addition to the logger set by WithLogger, which it doesn't replace, and is not changed
+// by SetLogger. It receives the calls of ILogger, IFetchLogger, ISessionLogger and ISessionEntriesObserver
+// with the same name as the logger. Like the expvar counters, it receives the cache and object pool hits
+// in ObservabilityMetricsOnly mode, but not in ObservabilityLoggerOnly mode.
+func WithMetricsLogger(logger ILogger) Option {
+	return func(c *options) {
+		c.metricsLogger = logger
 	}
+}
 
-	for _, opt := range opts {
-		opt(&m.op)
+// WithLeakThreshold enables a warning when the number of live sessions exceeds n.
+// Live sessions are the ones that used the cache and were not finished with EndSession yet,
+// so a growing number of them usually means forgotten EndSession calls.
+// The warning is sent to the logger if it implements ISessionLeakLogger, not more than once per second.
+// By default, the check is disabled.
+func WithLeakThreshold(n int) Option {
+	return func(c *options) {
+		c.leakThreshold = n
 	}
+}
 
-	m.objectsPool = newObjectSyncPool[T](m.op.name, m.objSize, m.op.logger)
-
-	return m
+// WithSlowFetchThreshold enables reporting of fetcher calls made by GetOrFetch that took longer than d.
+// The report is sent to the logger if it implements ISlowFetchLogger.
+// The key is converted to a string with its String method if it implements fmt.Stringer.
+// By default, the check is disabled.
+func WithSlowFetchThreshold(d time.Duration) Option {
+	return func(c *options) {
+		c.slowFetchThreshold = d
+	}
 }
 
-// NewObject creates a new object of type T.
-func (m *ReqCache[K, T]) NewObject(ctx context.Context) *T {
-	requestKey := fromContext(ctx)
+// WithRejectNil makes Put return ErrNilValue for nil values instead of caching them.
+// It also applies to nil values returned by GetOrFetch fetchers.
+// By default, nil values are cached like any other values.
+func WithRejectNil() Option {
+	return func(c *options) {
+		c.rejectNil = true
+	}
+}
 
-	m.muObjects.Lock()
-	defer m.muObjects.Unlock()
+// WithOwnerCheck allows ending a session only with the context returned by NewSession.
+// EndSession returns ErrWrongSessionOwner for contexts returned by ShareSession,
+// which helps to catch goroutines ending a session that is still used by its owner.
+// By default, any context with the session can end it.
+func WithOwnerCheck() Option {
+	return func(c *options) {
+		c.ownerCheck = true
+	}
+}
 
-	p, ok := m.objects[requestKey]
-	if !ok {
-		p = m.objectsPool.Get()
-		m.objects[requestKey] = p
+// WithFetchFailureCaching makes GetOrFetch remember fetcher errors for d within the session.
+// Until the error expires, GetOrFetch for the same key returns it without calling the fetcher again,
+// which prevents hammering a failing dependency, for example, when the request retries an operation.
+// Context errors are not remembered. By default, errors are not remembered.
+func WithFetchFailureCaching(d time.Duration) Option {
+	return func(c *options) {
+		c.fetchFailureTTL = d
 	}
+}
 
-	return p.get(ctx)
+// WithFetchKeyNormalizer makes concurrent GetOrFetch calls within a session share one fetcher call
+// if their keys are equal after normalization, for example, keys that differ only in case.
+// Without it, only the calls for equal keys share the fetcher call.
+// The result is still cached under the original keys. K must match the cache key type, otherwise New panics.
+func WithFetchKeyNormalizer[K comparable](normalize func(K) K) Option {
+	return func(c *options) {
+		c.fetchKeyNormalizer = normalize
+	}
 }
 
-// Put saves data in the cache.
-func (m *ReqCache[K, T]) Put(ctx context.Context, dataKey K, data *T) {
-	m.checkCache()
+// WithContextCancellationChecks makes Put, GetOrFetch, GetOrFetchWithSource, GetOrFetchAlias, GetOrNew
+// and WithoutEviction return the context error without doing anything if the context is canceled.
+// EndSession works regardless of the context state.
+// By default, the context is used only to find the session, except for the cache misses of GetOrFetch.
+func WithContextCancellationChecks() Option {
+	return func(c *options) {
+		c.cancellationChecks = true
+	}
+}
 
-	requestKey := fromContext(ctx)
+// WithAutoGrow lets the session's cache grow instead of evicting entries.
+// The capacity starts at cacheSize and doubles, up to maxSize, whenever adding an entry would cause an eviction.
+// After reaching maxSize, the cache evicts entries as usual. The capacity is reset when the session ends.
+// Requires a backend implementing Resizer (the default LRU backend does), otherwise it has no effect.
+func WithAutoGrow(maxSize int) Option {
+	return func(c *options) {
+		c.autoGrowMaxSize = maxSize
+	}
+}
 
-	m.muData.Lock()
-	defer m.muData.Unlock()
+// WithContextKeyPrefix makes every operation use the key prefixed by the string derived from the context
+// (for example, tenant id), so the same key never collides between different prefixes.
+// The prefix and the key are separated by a zero byte. KeysInto and Filter return the prefixed keys.
+// It is supported only for string-like keys, the key type must be specified explicitly:
+//
+//	cache := New[string, Data](0, 100, WithContextKeyPrefix[string](tenantFromContext))
+func WithContextKeyPrefix[K ~string](prefix func(ctx context.Context) string) Option {
+	return func(c *options) {
+		c.contextKey = func(ctx context.Context, k K) K {
+			return K(prefix(ctx)) + "\x00" + k
+		}
+	}
+}
 
-	d, ok := m.data[requestKey]
-	if !ok {
-		d = m.dataPool.Get()
-		m.data[requestKey] = d
+// WithObjectByteBudget sets the size of the array of preallocated objects in bytes instead of the object count.
+// The array length is maxBytes divided by the object size returned by sizeOf, the objSize argument of New is ignored.
+// New panics if the budget doesn't fit at least one object.
+func WithObjectByteBudget(maxBytes int64, sizeOf func() int64) Option {
+	return func(c *options) {
+		c.objectByteBudget = maxBytes
+		c.objectSizeOf = sizeOf
 	}
+}
 
-	d.Add(dataKey, data)
+// WithValueFinalizer sets a function called for every value that leaves the cache: evicted to free space,
+// replaced by Put or Move with another value, removed by Delete or by the end of the session.
+// It is useful for values holding resources (files, connections) that must be released.
+// The finalizer is called without holding the cache locks, so it may use the cache. It isn't called for nil values
+// and for evictions made by backends not implementing EvictionNotifier. If the same value is stored under several
+// keys, the finalizer is called for each of them.
+// T must match the value type of the cache, otherwise New panics.
+func WithValueFinalizer[T any](finalize func(value *T)) Option {
+	return func(c *options) {
+		c.valueFinalizer = finalize
+	}
 }
 
-// Exists checks if the data exists in the cache.
-func (m *ReqCache[K, T]) Exists(ctx context.Context, dataKey K) (found bool) { //nolint:nonamedreturns // false positive
-	if m.op.logger != nil {
-		defer func() { m.op.logger.LogCacheHitRatio(ctx, m.op.name, found) }()
+// WithEvictCallback sets a function called for every entry evicted from a session to free space, e.g. when
+// the working set exceeds cacheSize, with the context of the operation that caused the eviction.
+// Unlike WithValueFinalizer, it isn't called for replaced, deleted and ended entries. The callback is called
+// without holding the cache locks, so it may use the cache. Evictions made by backends not implementing
+// EvictionNotifier aren't reported. K and T must match the cache types, otherwise New panics.
+func WithEvictCallback[K comparable, T any](fn func(ctx context.Context, key K, value *T)) Option {
+	return func(c *options) {
+		c.evictCallback = fn
 	}
+}
 
-	m.checkCache()
+// WithOverflowPool makes the objects created by NewObject after the preallocated array is exhausted
+// come from a sync.Pool and return to it by EndSession, instead of being allocated and left to the garbage collector.
+// It reduces the GC pressure for large T if sessions regularly exceed objSize.
+// The recycled objects are zeroed before reuse. Like the preallocated ones, they must not be used after EndSession.
+func WithOverflowPool() Option {
+	return func(c *options) {
+		c.overflowPool = true
+	}
+}
 
-	requestKey := fromContext(ctx)
+// WithFetchRetry makes GetOrFetch and similar methods call a failing fetcher up to attempts times in total.
+// Before the retry number attempt (starting from 1) they wait for backoff(attempt), nil backoff means no waiting.
+// If the context is done while waiting, the context error is returned. If all attempts fail, the error of the last
+// attempt is returned. With WithFetchFailureCaching, only the final result of the retries is remembered.
+func WithFetchRetry(attempts int, backoff func(attempt int) time.Duration) Option {
+	return func(c *options) {
+		c.fetchAttempts = attempts
+		c.fetchBackoff = backoff
+	}
+}
 
-	m.muData.RLock()
-	defer m.muData.RUnlock()
+// WithStrictFetcherResults makes GetOrFetchMany return ErrUnexpectedFetcherKey if the fetcher returns keys
+// that weren't requested. By default, such keys are ignored, so a misbehaving fetcher can't flood the cache.
+func WithStrictFetcherResults() Option {
+	return func(c *options) {
+		c.strictFetcherResults = true
+	}
+}
 
-	d, ok := m.data[requestKey]
-	if !ok {
-		return false
+// WithLockFreeSessionMap makes Get and Exists find the session's storage without taking the cache lock,
+// using a copy of the session map that is updated when a session stores its first value or ends.
+// It targets workloads with extreme read concurrency, where the shared read lock becomes a bottleneck,
+// at the cost of slightly slower session start and end.
+// The backend must be safe for reads concurrent with writes, which is true for the default LRU backend.
+// Get and Exists must not race with EndSession of the same session.
+func WithLockFreeSessionMap() Option {
+	return func(c *options) {
+		c.lockFreeSessionMap = true
 	}
+}
 
-	return d.Contains(dataKey)
+// WithClock sets the source of the current time used for the age of the cached data, the idle time and the TTL
+// of the entries and the expiration of the remembered fetcher errors. By default, time.Now is used.
+// It is intended for tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *options) {
+		c.now = now
+	}
 }
 
-// Delete deletes data from the cache.
-func (m *ReqCache[K, T]) Delete(ctx context.Context, dataKey K) bool {
-	m.checkCache()
+// WithKeySizeWarning makes Put and other methods storing data report the keys whose size estimated by sizeOf
+// exceeds maxBytes to a logger implementing IKeySizeLogger. It is a guardrail for catching accidentally huge keys,
+// which bloat the cache and slow down hashing. The keys are stored anyway.
+// K must match the cache key type, otherwise New panics.
+func WithKeySizeWarning[K comparable](maxBytes int, sizeOf func(K) int) Option {
+	return func(c *options) {
+		c.keySizeLimit = maxBytes
+		c.keySizeOf = sizeOf
+	}
+}
 
-	requestKey := fromContext(ctx)
+// WithAutoEndOnEmpty makes Delete return the session's storage to the pool when it deletes the last entry,
+// if the session hasn't created objects by NewObject and isn't inside WithoutEviction.
+// The storage is created again by the next write. It minimizes the memory held by sparse sessions.
+// The session itself stays live until EndSession.
+func WithAutoEndOnEmpty() Option {
+	return func(c *options) {
+		c.autoEndOnEmpty = true
+	}
+}
 
-	m.muData.Lock()
-	defer m.muData.Unlock()
+// WithSizeSanity makes New panic (and Builder.Build return an error) if one of objSize and cacheSize
+// is more than maxRatio times larger than the other, which usually means that they were swapped.
+// The check is skipped if one of the sizes is 0.
+func WithSizeSanity(maxRatio int) Option {
+	return func(c *options) {
+		c.sizeSanityRatio = maxRatio
+	}
+}
 
-	d, ok := m.data[requestKey]
-	if !ok {
-		return false
+// WithOnFirstOverflow sets a function called once per session when NewObject exhausts the preallocated objects
+// of the session for the first time. Unlike the logger, which is called for every object, it is a low-noise signal
+// that requests regularly outgrow objSize. The name is the same as passed to the logger.
+func WithOnFirstOverflow(fn func(ctx context.Context, name string, sessionID uint64)) Option {
+	return func(c *options) {
+		c.onFirstOverflow = fn
 	}
+}
 
-	return d.Remove(dataKey)
+// WithObjectBudget limits the number of objects a session can create by NewObject and TryNewObject,
+// including the ones allocated after the preallocated objects are exhausted. Unlike objSize, which only sizes
+// the preallocated memory, it is a hard limit to surface runaway allocations, e.g. by a buggy loop.
+// After the budget is used up, TryNewObject returns ErrObjectBudgetExceeded and NewObject panics with it.
+// By default, the number of objects is unlimited.
+func WithObjectBudget(maxPerSession int) Option {
+	return func(c *options) {
+		c.objectBudget = maxPerSession
+	}
 }
 
-// Get returns data from the cache.
-func (m *ReqCache[K, T]) Get(ctx context.Context, dataKey K) (obj *T, found bool) { //nolint:nonamedreturns,lll // false positive
-	if m.op.logger != nil {
-		defer func() { m.op.logger.LogCacheHitRatio(ctx, m.op.name, found) }()
+// New creates a new instance of ReqCache.
+// objSize is the size of the array of objects of type T, preallocating memory for them.
+// cacheSize is the size of the cache in a single request.
+func New[K comparable, T any](objSize, cacheSize int, opts ...Option) *ReqCache[K, T] {
+	m := &ReqCache[K, T]{
+		lookups:            lookupCounters{getHits: 0, getMisses: 0, hits: 0, misses: 0},
+		liveSessions:       0,
+		poolStats:          poolCounters{reuses: 0, overflows: 0, objects: 0},
+		lifetime:           lifetimeCounters{}, //nolint:exhaustruct // zero counters
+		hasSnapshots:       0,
+		expiringSessions:   0,
+		op:                 options{}, //nolint:exhaustruct // default values
+		logger:             nil,
+		cacheSize:          cacheSize,
+		objSize:            objSize,
+		objectsPool:        nil,
+		poolReturner:       nil,
+		dataPool:           nil,
+		lockFreeData:       nil,
+		fetchKeyNormalizer: nil,
+		contextKey:         nil,
+		valueFinalizer:     nil,
+		evictCallback:      nil,
+		keySizeOf:          nil,
+		excludedKeyFields:  nil,
+		expvars:            nil,
+		objectShards:       nil,
+		dataShards:         nil,
+		sessionShards:      nil,
+		scratchPool:        &sync.Pool{New: nil},
+		leakWarnings:       newRateLimiter(warningInterval),
+		keySizeWarnings:    newRateLimiter(warningInterval),
+		evictionWarnings:   newRateLimiter(warningInterval),
 	}
 
-	m.checkCache()
+	for _, opt := range opts {
+		opt(&m.op)
+	}
 
-	requestKey := fromContext(ctx)
+	if m.op.shards <= 0 {
+		m.op.shards = defaultShards
+	}
+	m.dataShards = newDataShards[K, T](m.op.shards)
+	m.objectShards = newObjectShards[T](m.op.shards)
+	m.sessionShards = newSessionShards[K, T](m.op.shards)
 
-	m.muData.RLock()
-	defer m.muData.RUnlock()
+	if m.op.sizeSanityRatio > 0 {
+		checkSizeRatio(objSize, cacheSize, m.op.sizeSanityRatio)
+	}
 
-	data, ok := m.data[requestKey]
-	if !ok {
-		return nil, false
+	backendFactory := newLRUBackend[K, T]
+	if m.op.unbounded {
+		if m.op.backendFactory != nil {
+			panic("WithUnbounded can't be combined with WithBackendFactory")
+		}
+		backendFactory = newUnboundedBackend[K, T]
+	}
+	if m.op.backendFactory != nil {
+		f, ok := m.op.backendFactory.(func(size int) Backend[K, T])
+		if !ok {
+			panic("backend factory doesn't match the cache types")
+		}
+		backendFactory = f
+	}
+
+	if m.op.fetchKeyNormalizer != nil {
+		f, ok := m.op.fetchKeyNormalizer.(func(K) K)
+		if !ok {
+			panic("fetch key normalizer doesn't match the cache key type")
+		}
+		m.fetchKeyNormalizer = f
+	}
+
+	if m.op.contextKey != nil {
+		f, ok := m.op.contextKey.(func(context.Context, K) K)
+		if !ok {
+			panic("context key prefix doesn't match the cache key type")
+		}
+		m.contextKey = f
+	}
+
+	if m.op.valueFinalizer != nil {
+		f, ok := m.op.valueFinalizer.(func(*T))
+		if !ok {
+			panic("value finalizer doesn't match the cache value type")
+		}
+		m.valueFinalizer = f
 	}
 
-	return data.Get(dataKey)
+	if m.op.evictCallback != nil {
+		f, ok := m.op.evictCallback.(func(context.Context, K, *T))
+		if !ok {
+			panic("evict callback doesn't match the cache key and value types")
+		}
+		m.evictCallback = f
+	}
+
+	if m.op.keySizeOf != nil {
+		f, ok := m.op.keySizeOf.(func(K) int)
+		if !ok {
+			panic("key size function doesn't match the cache key type")
+		}
+		m.keySizeOf = f
+	}
+
+	if m.op.structKeyNormalization {
+		var key K
+		m.excludedKeyFields = excludedKeyFields(reflect.TypeOf(key))
+	}
+
+	if m.op.expvarName != "" && m.op.observabilityMode != ObservabilityLoggerOnly {
+		m.expvars = newExpvarCounters(m.op.expvarName)
+	}
+
+	if m.op.objectSizeOf != nil {
+		m.objSize = objectsInBudget(m.op.objectByteBudget, m.op.objectSizeOf())
+	}
+
+	if m.op.lockFreeSessionMap {
+		m.lockFreeData = &sync.Map{}
+	}
+
+	m.dataPool = newPoolWrapper[K, T](m.cacheSize, backendFactory)
+	m.logger = newLoggerHolder(m.op.name, m.op.logger)
+	m.logger.setMetrics(m.op.metricsLogger)
+	_, isSessionLogger := m.op.logger.(ISessionLogger)
+	_, isSessionMetrics := m.op.metricsLogger.(ISessionLogger)
+	if isSessionLogger || isSessionMetrics || m.op.leakThreshold > 0 {
+		enableLiveRegistry()
+	}
+	m.logger.perCallDisabled = m.op.observabilityMode == ObservabilityMetricsOnly
+	m.logger.metricsPerCallDisabled = m.op.observabilityMode == ObservabilityLoggerOnly
+	m.objectsPool = newObjectSyncPool[T](m.objSize, m.logger)
+	if m.op.overflowPool {
+		m.objectsPool.enableOverflowPool()
+	}
+	m.objectsPool.onFirstOverflow = m.op.onFirstOverflow
+	m.objectsPool.budget = m.op.objectBudget
+	if m.op.batchedPoolReturns {
+		m.poolReturner = newPoolReturner(m.dataPool, m.objectsPool)
+	}
+
+	return m
 }
 
-// GetOrFetch returns data from the cache or fetches it from the fetcher function,
-// for example, from the database.
-func (m *ReqCache[K, T]) GetOrFetch(ctx context.Context, dataKey K,
-	fetcher func(context.Context) (*T, error),
-) (*T, error) {
-	v, ok := m.Get(ctx, dataKey)
-	if ok {
-		return v, nil
+// NewCacheOnly creates a new instance of ReqCache used only for caching, without preallocated objects.
+// NewObject still works, but allocates every object. Panics if cacheSize is not positive.
+func NewCacheOnly[K comparable, T any](cacheSize int, opts ...Option) *ReqCache[K, T] {
+	if cacheSize <= 0 {
+		panic("cache size must be greater than 0")
 	}
 
-	obj, err := fetcher(ctx)
-	if err != nil {
-		return nil, err
+	return New[K, T](0, cacheSize, opts...)
+}
+
+// checkSizeRatio panics if one of the positive sizes is more than maxRatio times larger than the other.
+func checkSizeRatio(objSize, cacheSize, maxRatio int) {
+	if objSize <= 0 || cacheSize <= 0 {
+		return
+	}
+
+	if objSize/cacheSize > maxRatio || cacheSize/objSize > maxRatio {
+		panic(fmt.Sprintf("objSize %d and cacheSize %d differ more than %d times, were they swapped?",
+			objSize, cacheSize, maxRatio))
 	}
+}
 
-	m.Put(ctx, dataKey, obj)
+// objectsInBudget returns the number of objects of the given size fitting into the byte budget.
+// Panics if it is less than one.
+func objectsInBudget(maxBytes, objectSize int64) int {
+	if objectSize <= 0 {
+		panic("object size must be positive")
+	}
 
-	return obj, nil
+	n := maxBytes / objectSize
+	if n < 1 {
+		panic("object byte budget doesn't fit a single object")
+	}
+
+	return int(n)
 }
 
-// GetOrNew returns data from the cache or creates it and prepares with the prepare function.
-func (m *ReqCache[K, T]) GetOrNew(ctx context.Context, dataKey K, prepare func(context.Context, *T) error) (*T, error) {
-	v, ok := m.Get(ctx, dataKey)
-	if ok {
-		return v, nil
+// NewObject creates a new object of type T.
+// Panics with ErrObjectBudgetExceeded if the budget set by WithObjectBudget is used up.
+func (m *ReqCache[K, T]) NewObject(ctx context.Context) *T {
+	obj := m.sessionObjects(ctx, fromContext(ctx)).get(ctx)
+	if obj == nil {
+		panic(ErrObjectBudgetExceeded)
 	}
 
-	obj := m.NewObject(ctx)
-	if err := prepare(ctx, obj); err != nil {
+	return obj
+}
+
+// TryNewObject works like NewObject, but returns ErrObjectBudgetExceeded instead of panicking
+// if the budget set by WithObjectBudget is used up.
+func (m *ReqCache[K, T]) TryNewObject(ctx context.Context) (*T, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	m.Put(ctx, dataKey, obj)
+	obj := m.sessionObjects(ctx, requestKey).get(ctx)
+	if obj == nil {
+		return nil, ErrObjectBudgetExceeded
+	}
 
 	return obj, nil
 }
 
-// EndSession deletes data from the cache.
-// It is recommended to call EndSession in the defer statement.
-// After calling EndSession, the cache object with the session context key is no longer usable.
-func (m *ReqCache[K, T]) EndSession(ctx context.Context) {
-	requestKey := fromContext(ctx)
+// Warm pre-faults the memory of the session's preallocated objects, so the first NewObject calls of the
+// latency-sensitive phase of the request don't incur page faults. It doesn't take any objects from the pool.
+// It is only beneficial for large pools spanning many memory pages, otherwise it just wastes time.
+func (m *ReqCache[K, T]) Warm(ctx context.Context) error {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return err
+	}
 
-	m.muData.Lock()
-	if v, ok := m.data[requestKey]; ok {
-		delete(m.data, requestKey)
-		m.dataPool.Put(v)
+	m.sessionObjects(ctx, requestKey).warm()
+
+	return nil
+}
+
+// sessionObjects returns the object pool of the session, creating it on the first call.
+func (m *ReqCache[K, T]) sessionObjects(ctx context.Context, requestKey uint64) *objectPool[T] {
+	shard := m.objectShard(requestKey)
+	shard.mu.Lock()
+	p, ok := shard.objects[requestKey]
+	if !ok {
+		p = m.objectsPool.Get(m.sessionObjSize(ctx))
+		shard.objects[requestKey] = p
 	}
-	m.muData.Unlock()
+	shard.mu.Unlock()
 
-	m.muObjects.Lock()
-	if v, ok := m.objects[requestKey]; ok {
-		delete(m.objects, requestKey)
-		m.objectsPool.Put(v)
+	if !ok {
+		m.trackSession(ctx, requestKey)
 	}
-	m.muObjects.Unlock()
+
+	return p
 }
 
-func (m *ReqCache[K, T]) checkCache() {
-	if m.cacheSize <= 0 {
-		panic("cache size must be greater than 0")
+// sessionObjSize returns the number of objects preallocated for the session, see NewSessionSized.
+func (m *ReqCache[K, T]) sessionObjSize(ctx context.Context) int {
+	if c := sessionOf(ctx); c != nil && c.session.objSize >= 0 {
+		return c.session.objSize
 	}
+
+	return m.objSize
 }
 
-// Option is a function for configuring ReqCache.
-type Option func(*options)
+// Put saves data in the cache.
+// Returns ErrNilValue if data is nil and WithRejectNil is set.
+func (m *ReqCache[K, T]) Put(ctx context.Context, dataKey K, data *T) error {
+	m.checkCache()
 
-type options struct {
-	name   string
-	logger ILogger
+	if err := m.checkContext(ctx); err != nil {
+		return err
+	}
+
+	if data == nil && m.op.rejectNil {
+		return ErrNilValue
+	}
+
+	m.store(ctx, dataKey, data, nil)
+	atomic.AddUint64(&m.lifetime.puts, 1)
+
+	if m.op.operationRecording {
+		m.recordOperation(ctx, Operation[K, T]{Kind: OperationPut, Key: dataKey, Value: data, Found: false})
+	}
+
+	return nil
 }
 
-type contextKeyType struct{}
+// PutMany saves all entries in the cache taking the lock once, e.g. the results of a batch fetch.
+// The entries are added in no particular order, so if there are more of them than cacheSize,
+// the cache evicts entries as usual during the insertion, including some of the added ones.
+// Returns ErrNilValue without saving anything if any value is nil and WithRejectNil is set.
+func (m *ReqCache[K, T]) PutMany(ctx context.Context, entries map[K]*T) error {
+	m.checkCache()
 
-//nolint:gochecknoglobals // ок for context key
-var (
-	contextKey = contextKeyType{}
-	requestID  uint64
-)
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return err
+	}
 
-// fromContext returns the key from the context.
-func fromContext(ctx context.Context) uint64 {
-	if ctx == nil {
-		panic("no reqcache key in context")
+	if err = m.checkContext(ctx); err != nil {
+		return err
 	}
 
-	v, ok := ctx.Value(contextKey).(uint64)
-	if !ok {
-		panic("no reqcache key in context")
+	if len(entries) == 0 {
+		return nil
 	}
 
-	return v
+	keys := make([]K, 0, len(entries))
+	for k, v := range entries {
+		if v == nil && m.op.rejectNil {
+			return ErrNilValue
+		}
+
+		if m.keySizeOf != nil {
+			m.checkKeySize(ctx, k)
+		}
+
+		keys = append(keys, k)
+	}
+
+	effectiveKeys := make([]K, len(keys))
+	for i, k := range keys {
+		effectiveKeys[i] = m.effectiveKey(ctx, k)
+	}
+
+	var removed removedEntries[K, T]
+
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	e, live := m.sessionEntry(ctx, requestKey)
+	removed.startedLive = live
+	for i, k := range keys {
+		m.add(ctx, e, effectiveKeys[i], entries[k], &removed)
+	}
+	shard.mu.Unlock()
+
+	m.afterStore(ctx, requestKey, &removed, effectiveKeys...)
+	atomic.AddUint64(&m.lifetime.puts, uint64(len(keys)))
+
+	if m.op.operationRecording {
+		for _, k := range keys {
+			m.recordOperation(ctx, Operation[K, T]{Kind: OperationPut, Key: k, Value: entries[k], Found: false})
+		}
+	}
+
+	return nil
+}
+
+// PutIfAbsent saves data in the cache only if there is no data for the key, and returns true in this case.
+// Otherwise, it returns false with the cached data. The check and the store are done atomically,
+// so exactly one of concurrent callers stores its data. The lookup isn't counted in the hit/miss statistics.
+// Returns ErrNilValue if data is nil and WithRejectNil is set.
+func (m *ReqCache[K, T]) PutIfAbsent(ctx context.Context, dataKey K, data *T) (bool, *T, error) {
+	m.checkCache()
+
+	if _, err := sessionFromContext(ctx); err != nil {
+		return false, nil, err
+	}
+
+	if err := m.checkContext(ctx); err != nil {
+		return false, nil, err
+	}
+
+	if data == nil && m.op.rejectNil {
+		return false, nil, ErrNilValue
+	}
+
+	existing, found := m.store(ctx, dataKey, data, func(*T) bool { return true })
+	if found {
+		return false, existing, nil
+	}
+
+	atomic.AddUint64(&m.lifetime.puts, 1)
+
+	if m.op.operationRecording {
+		m.recordOperation(ctx, Operation[K, T]{Kind: OperationPut, Key: dataKey, Value: data, Found: false})
+	}
+
+	return true, nil, nil
+}
+
+// GetOrPut returns the cached data for the key with true or, if there is none, caches def and returns it with false.
+// The check and the store are done atomically, so concurrent callers get the same data.
+// The lookup is counted in the hit/miss statistics like Get.
+// Returns ErrNilValue if def is nil and WithRejectNil is set.
+func (m *ReqCache[K, T]) GetOrPut(ctx context.Context, dataKey K, def *T) (*T, bool, error) {
+	m.checkCache()
+
+	if _, err := sessionFromContext(ctx); err != nil {
+		return nil, false, err
+	}
+
+	if err := m.checkContext(ctx); err != nil {
+		return nil, false, err
+	}
+
+	if def == nil && m.op.rejectNil {
+		return nil, false, ErrNilValue
+	}
+
+	obj, loaded := m.store(ctx, dataKey, def, func(*T) bool { return true })
+	m.recordCacheHit(ctx, dataKey, loaded)
+
+	return obj, loaded, nil
+}
+
+// store saves data in the cache and returns it with false. If keep is not nil and the key exists, keep is called
+// with the cached data under the lock, and if it returns true, the cached data is returned with true instead
+// without updating its recency.
+func (m *ReqCache[K, T]) store(ctx context.Context, dataKey K, data *T, keep func(existing *T) bool) (*T, bool) {
+	if m.keySizeOf != nil {
+		m.checkKeySize(ctx, dataKey)
+	}
+
+	dataKey = m.effectiveKey(ctx, dataKey)
+
+	requestKey := fromContext(ctx)
+
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	e, live := m.sessionEntry(ctx, requestKey)
+
+	if keep != nil {
+		// the entry is found only if it existed, so the session was registered before
+		if existing, found := e.backend.Peek(dataKey); found && keep(existing) {
+			shard.mu.Unlock()
+			return existing, true
+		}
+	}
+
+	removed := removedEntries[K, T]{startedLive: live} //nolint:exhaustruct // nothing is removed yet
+	m.add(ctx, e, dataKey, data, &removed)
+	shard.mu.Unlock()
+
+	m.afterStore(ctx, requestKey, &removed, dataKey)
+
+	return data, false
+}
+
+// removedEntries contains the entries removed from the session's storage by adding data.
+type removedEntries[K comparable, T any] struct {
+	collect       bool // whether the entries are collected, see add
+	startedLive   int  // number of live sessions if the session was registered by the store, see registerSession
+	evicted       []K  // keys evicted to free space
+	evictedValues []*T
+	replaced      []*T // values replaced by the added ones
+}
+
+// add adds data to the session's storage, collecting the removed entries if they are reported to the logger
+// or the finalizer, and sets the expiration time of the key. Must be called under the write lock of the session's
+// data shard.
+func (m *ReqCache[K, T]) add(ctx context.Context, e *sessionData[K, T], dataKey K, data *T,
+	removed *removedEntries[K, T],
+) {
+	d := e.backend
+
+	if m.op.autoGrowMaxSize > m.cacheSize {
+		m.growBeforeAdd(e, dataKey)
+	}
+
+	if !removed.collect {
+		_, logger := m.logger.get(ctx)
+		_, reportEvictions := logger.(IEvictionLogger)
+		removed.collect = reportEvictions || m.valueFinalizer != nil || m.evictCallback != nil ||
+			m.op.idleTimeout > 0 || m.op.ttl > 0 || len(e.expirations) > 0
+	}
+
+	if !removed.collect {
+		d.Add(dataKey, data)
+		return
+	}
+
+	if old, found := d.Peek(dataKey); found && old != data {
+		removed.replaced = append(removed.replaced, old)
+	}
+	evictedKeys, evictedValues := collectEvictions(d, func() { d.Add(dataKey, data) })
+	removed.evicted = append(removed.evicted, evictedKeys...)
+	removed.evictedValues = append(removed.evictedValues, evictedValues...)
+
+	m.forgetExpirations(e, evictedKeys...)
+	if m.op.ttl > 0 {
+		m.setExpiration(e, dataKey, m.now().Add(m.op.ttl))
+	} else {
+		m.forgetExpirations(e, dataKey) // the data stored without TTL doesn't expire
+	}
+}
+
+// afterStore updates the session state for the stored keys and reports the removed entries.
+// It is called without holding the cache locks.
+func (m *ReqCache[K, T]) afterStore(ctx context.Context, requestKey uint64, removed *removedEntries[K, T],
+	dataKeys ...K,
+) {
+	if removed.startedLive > 0 {
+		m.sessionStarted(ctx, removed.startedLive)
+	}
+
+	if m.op.idleTimeout > 0 {
+		state := m.trackSession(ctx, requestKey)
+
+		now := m.now()
+		for _, dataKey := range dataKeys {
+			state.touch(dataKey, now)
+		}
+		state.forgetAccess(removed.evicted...)
+	}
+
+	if _, logger := m.logger.get(ctx); logger != nil {
+		if evictionLogger, ok := logger.(IEvictionLogger); ok {
+			m.logEvictions(ctx, evictionLogger, removed.evicted)
+		}
+	}
+
+	m.onEvict(ctx, removed.evicted, removed.evictedValues)
+	m.finalize(removed.replaced...)
+	m.finalize(removed.evictedValues...)
+}
+
+// onEvict calls the callback set by WithEvictCallback for the evicted entries.
+// Must not be called under the data shard lock.
+func (m *ReqCache[K, T]) onEvict(ctx context.Context, keys []K, values []*T) {
+	if m.evictCallback == nil {
+		return
+	}
+
+	for i, k := range keys {
+		m.evictCallback(ctx, k, values[i])
+	}
+}
+
+// sessionBackend returns the session's data storage, taking a new one from the pool if needed.
+// The session must be registered by trackSession before.
+// Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) sessionBackend(ctx context.Context, requestKey uint64) Backend[K, T] {
+	e, _ := m.sessionEntry(ctx, requestKey)
+
+	return e.backend
+}
+
+// sessionEntry works like sessionBackend, but returns the session's entry and registers the session if needed.
+// Returns the result of registerSession for the session start to be reported after releasing the lock.
+func (m *ReqCache[K, T]) sessionEntry(ctx context.Context, requestKey uint64) (*sessionData[K, T], int) {
+	shard := m.dataShard(requestKey)
+
+	if e, ok := shard.data[requestKey]; ok {
+		return e, 0
+	}
+
+	state, live := m.registerSession(ctx, requestKey, false)
+
+	e := m.dataPool.Get()
+	e.state = state
+	shard.data[requestKey] = e
+	if m.lockFreeData != nil {
+		m.lockFreeData.Store(requestKey, e)
+	}
+
+	return e, live
+}
+
+// releaseBackend removes the session's entry with its storage and returns it to the pool.
+// Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) releaseBackend(requestKey uint64) {
+	shard := m.dataShard(requestKey)
+
+	e, ok := shard.data[requestKey]
+	if !ok {
+		return
+	}
+
+	delete(shard.data, requestKey)
+	if m.lockFreeData != nil {
+		m.lockFreeData.Delete(requestKey)
+	}
+
+	if len(e.expirations) > 0 {
+		atomic.AddInt32(&m.expiringSessions, -1)
+		e.expirations = nil
+	}
+
+	if m.poolReturner != nil {
+		m.poolReturner.putData(e)
+	} else {
+		m.dataPool.Put(e)
+	}
+}
+
+// releaseEmpty releases the empty storage of the session for WithAutoEndOnEmpty, unless the session has objects
+// or is inside WithoutEviction, which resizes the storage when it finishes.
+// Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) releaseEmpty(requestKey uint64) {
+	if _, hasObjects := m.sessionObjectsIfAny(requestKey); hasObjects {
+		return
+	}
+
+	e, ok := m.dataShard(requestKey).data[requestKey]
+	if !ok {
+		return
+	}
+
+	if e.state.noEvictionDepth > 0 {
+		return
+	}
+	e.state.growCapacity = 0 // the next storage starts with the base capacity
+
+	m.releaseBackend(requestKey)
+}
+
+// loadEntry returns the session's entry for Get and Exists without taking the data shard lock.
+// The third return value is false if WithLockFreeSessionMap isn't set and the lock must be used instead.
+func (m *ReqCache[K, T]) loadEntry(requestKey uint64) (*sessionData[K, T], bool, bool) {
+	if m.lockFreeData == nil {
+		return nil, false, false
+	}
+
+	v, ok := m.lockFreeData.Load(requestKey)
+	if !ok {
+		return nil, false, true
+	}
+
+	e, _ := v.(*sessionData[K, T])
+
+	return e, true, true
+}
+
+// growBeforeAdd doubles the capacity of the session's storage (up to the WithAutoGrow limit)
+// if adding the key would cause an eviction. Must be called under the write lock of the session's data shard.
+func (m *ReqCache[K, T]) growBeforeAdd(e *sessionData[K, T], dataKey K) {
+	d := e.backend
+
+	r, ok := d.(Resizer)
+	if !ok {
+		return
+	}
+
+	state := e.state
+	capacity := state.capacity(m.cacheSize)
+
+	if capacity >= m.op.autoGrowMaxSize || d.Len() < capacity || d.Contains(dataKey) {
+		return
+	}
+
+	state.growCapacity = capacity * 2 //nolint:gomnd // doubling
+	if state.growCapacity > m.op.autoGrowMaxSize {
+		state.growCapacity = m.op.autoGrowMaxSize
+	}
+
+	if state.noEvictionDepth == 0 {
+		r.Resize(state.growCapacity)
+	}
+}
+
+// WithoutEviction calls fn, letting the session's cache grow beyond cacheSize until fn returns.
+// Afterwards the capacity is restored and the oldest entries are evicted down to cacheSize.
+// It is useful for bulk loads that need all entries at once. Nested calls are allowed.
+// Returns ErrResizeNotSupported if the backend doesn't implement Resizer, otherwise the error of fn.
+func (m *ReqCache[K, T]) WithoutEviction(ctx context.Context, fn func() error) error {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = m.checkContext(ctx); err != nil {
+		return err
+	}
+
+	state := m.trackSession(ctx, requestKey)
+
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	d := m.sessionBackend(ctx, requestKey)
+	r, ok := d.(Resizer)
+	if ok {
+		state.noEvictionDepth++
+		if state.noEvictionDepth == 1 {
+			r.Resize(math.MaxInt)
+		}
+	}
+	shard.mu.Unlock()
+
+	if !ok {
+		return ErrResizeNotSupported
+	}
+
+	defer func() {
+		var (
+			evictedKeys []K
+			evicted     []*T
+		)
+
+		shard.mu.Lock()
+		state.noEvictionDepth--
+		if state.noEvictionDepth == 0 {
+			// the session could be ended by fn, then its storage is already returned to the pool
+			current, _ := m.lookupSession(requestKey)
+			alive := current == state
+
+			if alive {
+				evictedKeys, evicted = collectEvictions(d, func() { r.Resize(state.capacity(m.cacheSize)) })
+				if e, ok := shard.data[requestKey]; ok {
+					m.forgetExpirations(e, evictedKeys...)
+				}
+			}
+		}
+		shard.mu.Unlock()
+
+		if m.op.idleTimeout > 0 {
+			state.forgetAccess(evictedKeys...)
+		}
+		m.onEvict(ctx, evictedKeys, evicted)
+		m.finalize(evicted...)
+	}()
+
+	return fn()
+}
+
+// checkKeySize reports the key to the logger if it is larger than the limit set by WithKeySizeWarning.
+func (m *ReqCache[K, T]) checkKeySize(ctx context.Context, dataKey K) {
+	size := m.keySizeOf(dataKey)
+	if size <= m.op.keySizeLimit {
+		return
+	}
+
+	name, logger := m.logger.get(ctx)
+	keySizeLogger, ok := logger.(IKeySizeLogger)
+	if !ok || !m.keySizeWarnings.allow(time.Now()) {
+		return
+	}
+
+	keySizeLogger.LogOversizedKey(ctx, name, keyString(dataKey), size)
+}
+
+// logEvictions reports evicted keys to the logger, respecting the rate limit.
+func (m *ReqCache[K, T]) logEvictions(ctx context.Context, logger IEvictionLogger, evicted []K) {
+	if len(evicted) == 0 || !m.evictionWarnings.allow(time.Now()) {
+		return
+	}
+
+	name, _ := m.logger.get(ctx)
+	logger.LogCacheEviction(ctx, name, keyString(evicted[0]))
+}
+
+// Exists checks if the data exists in the cache.
+func (m *ReqCache[K, T]) Exists(ctx context.Context, dataKey K) bool {
+	m.checkCache()
+
+	requestKey := fromContext(ctx)
+
+	_, found, counted := m.lookup(ctx, requestKey, m.effectiveKey(ctx, dataKey), true)
+	if !counted {
+		found = found && !m.ttlExpired(ctx, dataKey)
+		m.countSessionLookup(ctx, requestKey, false, found)
+	}
+	m.reportLookup(ctx, dataKey, found)
+
+	return found
+}
+
+// Delete deletes data from the cache.
+func (m *ReqCache[K, T]) Delete(ctx context.Context, dataKey K) bool {
+	removed := m.delete(ctx, dataKey)
+	atomic.AddUint64(&m.lifetime.deletes, 1)
+
+	if m.op.operationRecording {
+		m.recordOperation(ctx, Operation[K, T]{Kind: OperationDelete, Key: dataKey, Value: nil, Found: removed})
+	}
+
+	return removed
+}
+
+// delete works like Delete without recording the operation.
+func (m *ReqCache[K, T]) delete(ctx context.Context, dataKey K) bool {
+	m.checkCache()
+
+	return m.deleteKey(ctx, fromContext(ctx), m.effectiveKey(ctx, dataKey))
+}
+
+// deleteKey works like delete, but takes the effective key, see effectiveKey.
+func (m *ReqCache[K, T]) deleteKey(ctx context.Context, requestKey uint64, dataKey K) bool {
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	e, ok := shard.data[requestKey]
+	if !ok {
+		shard.mu.Unlock()
+		return false
+	}
+
+	d := e.backend
+	value, _ := d.Peek(dataKey)
+	removed := d.Remove(dataKey)
+	if removed {
+		m.forgetExpirations(e, dataKey)
+	}
+	if removed && m.op.autoEndOnEmpty && d.Len() == 0 {
+		m.releaseEmpty(requestKey)
+	}
+	shard.mu.Unlock()
+
+	if removed {
+		if m.op.idleTimeout > 0 {
+			m.trackSession(ctx, requestKey).forgetAccess(dataKey)
+		}
+		m.finalize(value)
+	}
+
+	return removed
+}
+
+// Move atomically moves the data from the from key to the to key. If the to key already exists,
+// its data is overwritten. The expiration time, the idle time and the tags of the data move with it.
+// Returns false if the from key doesn't exist.
+func (m *ReqCache[K, T]) Move(ctx context.Context, from, to K) (bool, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err = m.checkContext(ctx); err != nil {
+		return false, err
+	}
+
+	from = m.effectiveKey(ctx, from)
+	to = m.effectiveKey(ctx, to)
+
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	e, ok := shard.data[requestKey]
+	if !ok {
+		shard.mu.Unlock()
+		return false, nil
+	}
+
+	d := e.backend
+	value, ok := d.Peek(from)
+	if !ok || from == to {
+		shard.mu.Unlock()
+		return ok, nil
+	}
+
+	replaced, _ := d.Peek(to)
+	d.Remove(from)
+	d.Add(to, value)
+	m.moveExpiration(e, from, to)
+	shard.mu.Unlock()
+
+	state, _ := m.lookupSession(requestKey)
+
+	if state != nil {
+		if m.op.idleTimeout > 0 {
+			state.moveAccess(from, to)
+		}
+		state.moveTags(from, to)
+	}
+
+	if replaced != value {
+		m.finalize(replaced)
+	}
+
+	return true, nil
+}
+
+// Get returns data from the cache.
+func (m *ReqCache[K, T]) Get(ctx context.Context, dataKey K) (*T, bool) {
+	m.checkCache()
+
+	requestKey := fromContext(ctx)
+
+	obj, found, counted := m.lookup(ctx, requestKey, m.effectiveKey(ctx, dataKey), false)
+	if !counted {
+		if found && m.expired(ctx, dataKey) {
+			obj, found = nil, false
+		}
+		m.countSessionLookup(ctx, requestKey, true, found)
+	}
+	m.reportLookup(ctx, dataKey, found)
+
+	if m.op.operationRecording {
+		m.recordOperation(ctx, Operation[K, T]{Kind: OperationGet, Key: dataKey, Value: obj, Found: found})
+	}
+
+	return obj, found
+}
+
+// lookup returns the session's data for the effective key for Get, or only checks that it exists for Exists
+// if contains is set. If the session has data and the found entry can't have expired, the lookup is counted
+// and the last return value is true. Otherwise, it is false, and the caller must check the expiration
+// of the found entry and count the lookup itself.
+func (m *ReqCache[K, T]) lookup(ctx context.Context, requestKey uint64, key K, contains bool) (*T, bool, bool) {
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		obj, found := snapshot.index[key]
+		return obj, found, false
+	}
+
+	// WithIdleTimeout doesn't apply to Exists
+	idle := !contains && m.op.idleTimeout > 0
+
+	if e, ok, lockFree := m.loadEntry(requestKey); lockFree {
+		if !ok {
+			return nil, false, false
+		}
+
+		obj, found := find(e.backend, key, contains)
+		// the expiration times can't be read without the lock
+		mayExpire := idle || atomic.LoadInt32(&m.expiringSessions) > 0
+
+		return obj, found, m.countEntryLookup(e, !contains, found, mayExpire)
+	}
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	e, ok := shard.data[requestKey]
+	if !ok {
+		return nil, false, false
+	}
+
+	obj, found := find(e.backend, key, contains)
+
+	return obj, found, m.countEntryLookup(e, !contains, found, idle || m.ttlPassed(e, key))
+}
+
+// find returns the data from the storage or, if contains is set, only checks that it exists.
+func find[K comparable, T any](d Backend[K, T], key K, contains bool) (*T, bool) {
+	if contains {
+		return nil, d.Contains(key)
+	}
+
+	return d.Get(key)
+}
+
+// HitRatio returns the ratio of cache hits to all lookups made by Get and Exists.
+// The counters are global across all sessions since the cache creation.
+// Returns 0 if there were no lookups.
+func (m *ReqCache[K, T]) HitRatio() float64 {
+	hits, misses, _ := m.lookups.load()
+
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
+
+// SetLogger replaces the logger and the cache name passed to it, set by WithLogger.
+// It is safe to call concurrently with other methods. Nil logger disables logging.
+func (m *ReqCache[K, T]) SetLogger(name string, logger ILogger) {
+	if _, isSessionLogger := logger.(ISessionLogger); isSessionLogger {
+		enableLiveRegistry()
+	}
+	m.logger.set(name, logger)
+}
+
+// recordCacheHit updates the hit/miss counters with the result of a lookup other than Get
+// and reports it to the logger.
+func (m *ReqCache[K, T]) recordCacheHit(ctx context.Context, dataKey K, hit bool) {
+	m.countSessionLookup(ctx, fromContext(ctx), false, hit)
+	m.reportLookup(ctx, dataKey, hit)
+}
+
+// reportLookup works like recordCacheHit, but doesn't update the hit/miss counters.
+func (m *ReqCache[K, T]) reportLookup(ctx context.Context, dataKey K, hit bool) {
+	// checked first, so lookups without tracking, expvars and loggers don't pay for the context lookups below
+	if !m.op.efficiencyTracking && m.expvars == nil && atomic.LoadUint32(&m.logger.enabled) == 0 {
+		return
+	}
+
+	if m.op.efficiencyTracking {
+		m.trackKeys(ctx, false, m.effectiveKey(ctx, dataKey))
+	}
+
+	if m.expvars != nil {
+		if hit {
+			m.expvars.hits.Add(1)
+		} else {
+			m.expvars.misses.Add(1)
+		}
+	}
+
+	name, loggers := m.logger.getPerCall(ctx)
+	for _, logger := range loggers {
+		if logger != nil {
+			logger.LogCacheHitRatio(ctx, name, hit)
+		}
+	}
+}
+
+// GetOrFetch returns data from the cache or fetches it from the fetcher function,
+// for example, from the database. Concurrent calls of the session for the same key share one fetcher call:
+// the others wait for it and get the same result. If the fetcher panics, all of them get ErrFetcherPanicked.
+// A waiting call whose context ends stops waiting and returns the context error, the shared call continues.
+// On a cache miss, the context error is returned if the context is canceled before the fetcher is called
+// or before its result is cached, so a canceled request doesn't fill the cache.
+func (m *ReqCache[K, T]) GetOrFetch(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	obj, _, err := m.GetOrFetchWithSource(ctx, dataKey, fetcher)
+
+	return obj, err
+}
+
+// GetOrFetchWithSource works like GetOrFetch, but also reports whether the data was taken from the cache.
+// The second return value is true on a cache hit and false if the fetcher was called.
+func (m *ReqCache[K, T]) GetOrFetchWithSource(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error),
+) (*T, bool, error) {
+	if err := m.checkContext(ctx); err != nil {
+		return nil, false, err
+	}
+
+	v, ok := m.Get(ctx, dataKey)
+	if ok {
+		return v, true, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	defer m.beginWrite(ctx)()
+
+	obj, err := m.fetchShared(ctx, dataKey, fetcher)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if err = m.Put(ctx, dataKey, obj); err != nil {
+		return nil, false, err
+	}
+
+	return obj, false, nil
+}
+
+// fetchShared works like fetch, but concurrent calls of the session for the same key share one fetcher call.
+// If WithFetchKeyNormalizer is set, the keys are compared after normalization.
+// If the shared fetcher call panics, all of them get an error wrapping ErrFetcherPanicked,
+// and the next call for the key calls the fetcher again.
+func (m *ReqCache[K, T]) fetchShared(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	obj, _, err := m.fetchSharedControlled(ctx, dataKey, func(ctx context.Context) (*T, CacheControl, error) {
+		v, err := fetcher(ctx)
+		return v, CacheControl{TTL: 0, NoStore: false}, err
+	})
+
+	return obj, err
+}
+
+// fetchSharedControlled works like fetchShared for the fetcher of GetOrFetchControlled.
+// The calls sharing the fetcher call get the same CacheControl.
+func (m *ReqCache[K, T]) fetchSharedControlled(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, CacheControl, error),
+) (*T, CacheControl, error) {
+	dataKey = m.effectiveKey(ctx, dataKey)
+
+	sharedKey := dataKey
+	if m.fetchKeyNormalizer != nil {
+		sharedKey = m.fetchKeyNormalizer(dataKey)
+	}
+
+	return m.trackSession(ctx, fromContext(ctx)).shareFetch(ctx, sharedKey, func() (*T, CacheControl, error) {
+		var control CacheControl
+		obj, err := m.fetchRecovered(ctx, dataKey, func(ctx context.Context) (*T, error) {
+			var (
+				v      *T
+				errGet error
+			)
+			v, control, errGet = fetcher(ctx)
+
+			return v, errGet
+		})
+
+		return obj, control, err
+	})
+}
+
+// fetchRecovered works like fetch, but converts a panic of the fetcher into an error wrapping ErrFetcherPanicked.
+// Otherwise, the panic would leave the callers sharing the fetcher call without a result.
+func (m *ReqCache[K, T]) fetchRecovered(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	var (
+		obj *T
+		err error
+	)
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrFetcherPanicked, r)
+			}
+		}()
+
+		obj, err = m.fetch(ctx, dataKey, fetcher)
+	}()
+
+	return obj, err
+}
+
+// RefreshIfChanged calls the fetcher regardless of the cached data, caches the result and reports whether it differs
+// from the previously cached data according to equal. The data is considered changed if nothing was cached.
+func (m *ReqCache[K, T]) RefreshIfChanged(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error), equal func(a, b *T) bool,
+) (*T, bool, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err = m.checkContext(ctx); err != nil {
+		return nil, false, err
+	}
+
+	defer m.beginWrite(ctx)()
+
+	obj, err := m.fetch(ctx, m.effectiveKey(ctx, dataKey), fetcher)
+	if err != nil {
+		return nil, false, err
+	}
+
+	old, found := m.peek(ctx, requestKey, dataKey)
+
+	if err = m.Put(ctx, dataKey, obj); err != nil {
+		return nil, false, err
+	}
+
+	return obj, !found || !equal(old, obj), nil
+}
+
+// RefreshIfOlderThan returns the cached data if it was fetched by RefreshIfOlderThan no more than maxAge ago.
+// Otherwise, it calls the fetcher, caches the result and returns it. The data cached by other methods has no known
+// age and is refreshed by the first call. The age is measured from the start of the fetch, see also WithClock.
+func (m *ReqCache[K, T]) RefreshIfOlderThan(ctx context.Context, dataKey K, maxAge time.Duration,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	key := m.effectiveKey(ctx, dataKey)
+	state := m.trackSession(ctx, requestKey)
+
+	if fetched, ok := state.fetchTime(key); ok && m.now().Sub(fetched) <= maxAge {
+		if v, found := m.Get(ctx, dataKey); found {
+			return v, nil
+		}
+	}
+
+	defer m.beginWrite(ctx)()
+
+	fetched := m.now()
+
+	obj, err := m.fetch(ctx, key, fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.Put(ctx, dataKey, obj); err != nil {
+		return nil, err
+	}
+
+	state.setFetchTime(key, fetched)
+
+	return obj, nil
+}
+
+// Peek works like Get, but doesn't update the recency of the data, so speculative lookups don't affect eviction.
+// The lookup is counted in the hit/miss statistics like Get.
+func (m *ReqCache[K, T]) Peek(ctx context.Context, dataKey K) (*T, bool, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var (
+		obj   *T
+		found bool
+	)
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		obj, found = snapshot.index[m.effectiveKey(ctx, dataKey)]
+	} else {
+		obj, found = m.peek(ctx, requestKey, dataKey)
+	}
+	if found && m.ttlExpired(ctx, dataKey) {
+		obj, found = nil, false
+	}
+	m.recordCacheHit(ctx, dataKey, found)
+
+	return obj, found, nil
+}
+
+// peek returns the session's data without updating its recency and the hit/miss counters.
+func (m *ReqCache[K, T]) peek(ctx context.Context, requestKey uint64, dataKey K) (*T, bool) {
+	dataKey = m.effectiveKey(ctx, dataKey)
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	d, ok := shard.backend(requestKey)
+	if !ok {
+		return nil, false
+	}
+
+	return d.Peek(dataKey)
+}
+
+// GetOrFetchAlias works like GetOrFetch for several keys that are aliases of the same data (for example, id and slug).
+// Returns the data cached under any of the keys. Otherwise calls the fetcher once and caches the result under all keys.
+func (m *ReqCache[K, T]) GetOrFetchAlias(ctx context.Context, keys []K,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if err := m.checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if v, ok := m.Get(ctx, k); ok {
+			return v, nil
+		}
+	}
+
+	defer m.beginWrite(ctx)()
+
+	obj, err := m.fetch(ctx, keys[0], fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if err = m.Put(ctx, k, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+// GetOrNew returns data from the cache or creates it and prepares with the prepare function.
+func (m *ReqCache[K, T]) GetOrNew(ctx context.Context, dataKey K, prepare func(context.Context, *T) error) (*T, error) {
+	if err := m.checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	v, ok := m.Get(ctx, dataKey)
+	if ok {
+		return v, nil
+	}
+
+	obj := m.NewObject(ctx)
+	if err := prepare(ctx, obj); err != nil {
+		return nil, err
+	}
+
+	if err := m.Put(ctx, dataKey, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// Len returns the number of entries cached in the session.
+func (m *ReqCache[K, T]) Len(ctx context.Context) (int, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		return len(snapshot.keys), nil
+	}
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	d, ok := shard.backend(requestKey)
+	if !ok {
+		return 0, nil
+	}
+
+	return d.Len(), nil
+}
+
+// KeysInto appends the keys cached in the session to dst, from the oldest to the newest, and returns the extended slice.
+// Passing the result of the previous call as dst[:0] reuses its memory, so the returned slice is only valid
+// until the next KeysInto call with the same buffer and reflects the keys at the moment of the call.
+// The default LRU backend still allocates an intermediate slice, backends implementing KeysAppender don't.
+func (m *ReqCache[K, T]) KeysInto(ctx context.Context, dst []K) ([]K, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return dst, err
+	}
+
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		return append(dst, snapshot.keys...), nil
+	}
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	d, ok := shard.backend(requestKey)
+	if !ok {
+		return dst, nil
+	}
+
+	if appender, ok := d.(KeysAppender[K]); ok {
+		return appender.AppendKeys(dst), nil
+	}
+
+	return append(dst, d.Keys()...), nil
+}
+
+// Range calls fn for the entries of the session, from the oldest to the newest, until fn returns false.
+// The entries are snapshotted before the first call, so fn may use the cache, including modifying it.
+// The recency of the entries is not updated.
+func (m *ReqCache[K, T]) Range(ctx context.Context, fn func(key K, value *T) bool) error {
+	keys, values, err := m.entries(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, k := range keys {
+		if !fn(k, values[i]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Filter returns all entries of the session for which pred returns true.
+// It doesn't modify the cache and doesn't update the recency of the entries.
+func (m *ReqCache[K, T]) Filter(ctx context.Context, pred func(key K, value *T) bool) (map[K]*T, error) {
+	keys, values, err := m.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[K]*T)
+	for i, k := range keys {
+		if pred(k, values[i]) {
+			res[k] = values[i]
+		}
+	}
+
+	return res, nil
+}
+
+// SnapshotCopy returns copies of all entries of the session made by clone. Unlike the cached values,
+// the copies remain valid after EndSession returns the pooled objects for reuse, so they can be passed to code
+// running after the end of the request. Nil values are not cloned.
+// It doesn't modify the cache and doesn't update the recency of the entries.
+func (m *ReqCache[K, T]) SnapshotCopy(ctx context.Context, clone func(*T) *T) (map[K]*T, error) {
+	keys, values, err := m.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[K]*T, len(keys))
+	for i, k := range keys {
+		if values[i] != nil {
+			res[k] = clone(values[i])
+		} else {
+			res[k] = nil
+		}
+	}
+
+	return res, nil
+}
+
+// Sorted returns all values of the session ordered by less. The sort is stable: equal values keep
+// the order from the oldest to the newest entry.
+// It doesn't modify the cache and doesn't update the recency of the entries.
+func (m *ReqCache[K, T]) Sorted(ctx context.Context, less func(a, b *T) bool) ([]*T, error) {
+	_, values, err := m.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return less(values[i], values[j])
+	})
+
+	return values, nil
+}
+
+// EndSession deletes data from the cache.
+// It is recommended to call EndSession in the defer statement.
+// After calling EndSession, the cache object with the session context key is no longer usable.
+// Returns ErrWrongSessionOwner if WithOwnerCheck is set and the context was returned by ShareSession.
+func (m *ReqCache[K, T]) EndSession(ctx context.Context) error {
+	requestKey := fromContext(ctx)
+
+	if err := m.checkOwner(ctx); err != nil {
+		return err
+	}
+
+	m.endSession(ctx, requestKey)
+
+	return nil
+}
+
+// EndStats contains statistics of a session collected by EndSessionStats.
+type EndStats struct {
+	// Entries is the number of entries in the session's data cache.
+	Entries int
+	// PooledObjectsUsed is the number of objects taken from the pre-allocated memory.
+	PooledObjectsUsed int
+	// OverflowObjects is the number of objects allocated because the pre-allocated memory was exhausted.
+	OverflowObjects int
+}
+
+// EndSessionStats works like EndSession, but also returns statistics of the session
+// collected right before its data was returned to the pools.
+func (m *ReqCache[K, T]) EndSessionStats(ctx context.Context) (EndStats, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return EndStats{}, err
+	}
+
+	if err = m.checkOwner(ctx); err != nil {
+		return EndStats{}, err
+	}
+
+	return m.endSession(ctx, requestKey), nil
+}
+
+// checkOwner returns ErrWrongSessionOwner if WithOwnerCheck is set and the context doesn't own the session.
+func (m *ReqCache[K, T]) checkOwner(ctx context.Context) error {
+	if !m.op.ownerCheck {
+		return nil
+	}
+
+	if c := sessionOf(ctx); c != nil && c.owner != c.session.id {
+		return ErrWrongSessionOwner
+	}
+
+	return nil
+}
+
+// ForceEndSession works like EndSession, but finds the session by its id instead of the context.
+// It is intended for cleaning up leaked sessions, for example, from a supervisor goroutine.
+// Ending an unknown or already finished session is a no-op. The session stops being counted by
+// MaxConcurrentSessions if it has used this cache, or if it started after a cache with WithLeakThreshold
+// or a session logger was created.
+func (m *ReqCache[K, T]) ForceEndSession(sessionID uint64) error {
+	if sessionID == 0 {
+		return ErrInvalidSessionID
+	}
+
+	m.endSession(context.Background(), sessionID)
+
+	return nil
+}
+
+// SessionID returns the id of the session in the context.
+func SessionID(ctx context.Context) (uint64, error) {
+	return sessionFromContext(ctx)
+}
+
+// endSession deletes the session's data and returns it to the pools.
+func (m *ReqCache[K, T]) endSession(ctx context.Context, requestKey uint64) EndStats {
+	var (
+		stats  EndStats
+		values []*T
+	)
+
+	shard := m.dataShard(requestKey)
+	shard.mu.Lock()
+	if v, ok := shard.backend(requestKey); ok {
+		stats.Entries = v.Len()
+		if m.valueFinalizer != nil {
+			for _, k := range v.Keys() {
+				value, _ := v.Peek(k)
+				values = append(values, value)
+			}
+		}
+		m.releaseBackend(requestKey)
+	}
+	shard.mu.Unlock()
+
+	m.finalize(values...)
+
+	objShard := m.objectShard(requestKey)
+	objShard.mu.Lock()
+	if v, ok := objShard.objects[requestKey]; ok {
+		stats.PooledObjectsUsed, stats.OverflowObjects = v.usage()
+		m.poolStats.record(stats.PooledObjectsUsed, stats.OverflowObjects)
+		atomic.AddUint64(&m.lifetime.overflows, uint64(stats.OverflowObjects))
+		if m.expvars != nil {
+			m.expvars.overflows.Add(int64(stats.OverflowObjects))
+		}
+		delete(objShard.objects, requestKey)
+		if m.poolReturner != nil {
+			m.poolReturner.putObjects(v)
+		} else {
+			m.objectsPool.Put(v)
+		}
+	}
+	objShard.mu.Unlock()
+
+	stateShard := m.sessionShard(requestKey)
+	stateShard.mu.Lock()
+	state, started := stateShard.sessions[requestKey]
+	liveFlag := sessionLiveFlag(ctx)
+	if liveFlag == nil && started {
+		liveFlag = state.live // ForceEndSession
+	}
+	// ended before the state is removed, so trackSession can't register the session again, see registerSession
+	endLiveSession(requestKey, liveFlag)
+	if started {
+		delete(stateShard.sessions, requestKey)
+		atomic.AddInt64(&m.liveSessions, -1)
+		if m.expvars != nil {
+			m.expvars.liveSessions.Add(-1)
+		}
+	}
+	stateShard.mu.Unlock()
+
+	if started {
+		atomic.AddUint64(&m.lifetime.sessionsEnded, 1)
+		m.releaseScratch(state)
+
+		name, loggers := m.logger.getAll(ctx)
+		for _, logger := range loggers {
+			if sessionLogger, ok := logger.(ISessionLogger); ok {
+				sessionLogger.LogSessionEnd(ctx, name, stats)
+			}
+			if observer, ok := logger.(ISessionEntriesObserver); ok {
+				observer.ObserveSessionEntries(ctx, name, stats.Entries)
+			}
+		}
+	}
+
+	return stats
+}
+
+// now returns the current time according to WithClock.
+func (m *ReqCache[K, T]) now() time.Time {
+	if m.op.now != nil {
+		return m.op.now()
+	}
+
+	return time.Now()
+}
+
+// fetch calls the fetcher for the data key.
+func (m *ReqCache[K, T]) fetch(ctx context.Context, dataKey K, fetcher func(context.Context) (*T, error)) (*T, error) {
+	if m.op.efficiencyTracking {
+		m.trackKeys(ctx, true, dataKey)
+	}
+
+	if m.op.fetchFailureTTL <= 0 {
+		return m.retryFetcher(ctx, dataKey, fetcher)
+	}
+
+	state := m.trackSession(ctx, fromContext(ctx))
+	if err := state.fetchFailure(dataKey, m.now()); err != nil {
+		return nil, err
+	}
+
+	obj, err := m.retryFetcher(ctx, dataKey, fetcher)
+	if isContextError(ctx, err) {
+		return obj, err // the fetch was interrupted, it says nothing about the dependency
+	}
+	state.setFetchFailure(dataKey, err, m.now().Add(m.op.fetchFailureTTL))
+
+	return obj, err
+}
+
+// isContextError reports whether err is caused by the context being canceled or timed out.
+func isContextError(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryFetcher calls the fetcher, retrying it if WithFetchRetry is set.
+func (m *ReqCache[K, T]) retryFetcher(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	obj, err := m.callFetcher(ctx, dataKey, fetcher)
+
+	for attempt := 1; err != nil && attempt < m.op.fetchAttempts; attempt++ {
+		if m.op.fetchBackoff != nil {
+			timer := time.NewTimer(m.op.fetchBackoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		obj, err = m.callFetcher(ctx, dataKey, fetcher)
+	}
+
+	return obj, err
+}
+
+// callFetcher calls the fetcher, measuring its duration if needed.
+func (m *ReqCache[K, T]) callFetcher(ctx context.Context, dataKey K,
+	fetcher func(context.Context) (*T, error),
+) (*T, error) {
+	name, loggers := m.logger.getAll(ctx)
+	_, logFetch := loggers[0].(IFetchLogger)
+	_, metricsLogFetch := loggers[1].(IFetchLogger)
+
+	if m.op.slowFetchThreshold <= 0 && !logFetch && !metricsLogFetch {
+		return fetcher(ctx)
+	}
+
+	start := time.Now()
+	obj, err := fetcher(ctx)
+	took := time.Since(start)
+
+	for _, logger := range loggers {
+		if fetchLogger, ok := logger.(IFetchLogger); ok {
+			fetchLogger.LogFetch(ctx, name, keyString(dataKey), took, err)
+		}
+	}
+
+	if m.op.slowFetchThreshold > 0 && took > m.op.slowFetchThreshold {
+		if slowLogger, ok := loggers[0].(ISlowFetchLogger); ok {
+			slowLogger.LogSlowFetch(ctx, name, keyString(dataKey), took)
+		}
+	}
+
+	return obj, err
+}
+
+// entries returns a snapshot of the session's keys and values in the LRU order (oldest first).
+// The recency of the entries is not updated.
+func (m *ReqCache[K, T]) entries(ctx context.Context) ([]K, []*T, error) {
+	m.checkCache()
+
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if snapshot, ok := m.readSnapshot(ctx); ok {
+		// copy, because callers may reorder the result
+		keys := append([]K(nil), snapshot.keys...)
+		values := append([]*T(nil), snapshot.values...)
+
+		return keys, values, nil
+	}
+
+	shard := m.dataShard(requestKey)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	d, ok := shard.backend(requestKey)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	keys := d.Keys()
+	values := make([]*T, 0, len(keys))
+	for _, k := range keys {
+		v, _ := d.Peek(k)
+		values = append(values, v)
+	}
+
+	return keys, values, nil
+}
+
+// finalize calls the finalizer set by WithValueFinalizer for the values removed from the cache.
+// Must not be called under the data shard lock.
+func (m *ReqCache[K, T]) finalize(values ...*T) {
+	if m.valueFinalizer == nil {
+		return
+	}
+
+	for _, v := range values {
+		if v != nil {
+			m.valueFinalizer(v)
+		}
+	}
+}
+
+// effectiveKey returns the key used in the session storage, normalized if WithStructKeyNormalization is set
+// and prefixed if WithContextKeyPrefix is set.
+func (m *ReqCache[K, T]) effectiveKey(ctx context.Context, dataKey K) K {
+	if m.excludedKeyFields != nil {
+		dataKey = normalizeStructKey(dataKey, m.excludedKeyFields)
+	}
+
+	if m.contextKey != nil {
+		dataKey = m.contextKey(ctx, dataKey)
+	}
+
+	return dataKey
+}
+
+// checkContext returns the context error if WithContextCancellationChecks is set.
+func (m *ReqCache[K, T]) checkContext(ctx context.Context) error {
+	if !m.op.cancellationChecks {
+		return nil
+	}
+
+	return ctx.Err()
+}
+
+func (m *ReqCache[K, T]) checkCache() {
+	if m.cacheSize <= 0 && !m.op.unbounded {
+		panic("cache size must be greater than 0")
+	}
+}
+
+// Option is a function for configuring ReqCache.
+type Option func(*options)
+
+type options struct {
+	name          string
+	logger        ILogger
+	metricsLogger ILogger
+
+	leakThreshold          int
+	slowFetchThreshold     time.Duration
+	backendFactory         any // func(size int) Backend[K, T]
+	unbounded              bool
+	rejectNil              bool
+	ownerCheck             bool
+	fetchFailureTTL        time.Duration
+	fetchKeyNormalizer     any // func(K) K
+	cancellationChecks     bool
+	autoGrowMaxSize        int
+	contextKey             any
+	objectByteBudget       int64
+	objectSizeOf           func() int64
+	valueFinalizer         any // func(*T)
+	evictCallback          any // func(context.Context, K, *T)
+	structKeyNormalization bool
+	expvarName             string
+	overflowPool           bool
+	strictFetcherResults   bool
+	fetchAttempts          int
+	fetchBackoff           func(attempt int) time.Duration
+	lockFreeSessionMap     bool
+	efficiencyTracking     bool
+	batchDeadline          time.Duration
+	now                    func() time.Time
+	observabilityMode      ObservabilityMode
+	keySizeLimit           int
+	keySizeOf              any // func(K) int
+	operationRecording     bool
+	batchedPoolReturns     bool
+	autoEndOnEmpty         bool
+	sizeSanityRatio        int
+	onFirstOverflow        func(ctx context.Context, name string, sessionID uint64)
+	objectBudget           int
+	shards                 int // number of data and object shards, set only by tests
+	idleTimeout            time.Duration
+	ttl                    time.Duration
+}
+
+type contextKeyType struct{}
+
+// sessionValue is a session started by NewSession, shared by the contexts returned by ShareSession.
+type sessionValue struct {
+	id      uint64
+	live    uint32        // 1 until the session ends on any cache, accessed atomically
+	objSize int           // set by NewSessionSized, negative for the objSize of the cache
+	names   *sessionNames // nil if the session has neither a namespace nor an operation name
+}
+
+// sessionNames contains the names of a session, which most sessions don't have.
+type sessionNames struct {
+	namespace string // set by NewSessionNamespaced
+	opName    string // set by NewSessionNamed
+}
+
+// sessionContext is the context returned by NewSession and ShareSession. It is used instead of context.WithValue,
+// so the session is stored in the same allocation as the context.
+type sessionContext struct {
+	context.Context
+
+	session *sessionValue // points to own for the context returned by NewSession
+	owner   uint64        // equal to the session id for the context returned by NewSession, unique for ShareSession
+	own     sessionValue
+}
+
+// Value returns the context itself for contextKey and delegates the other keys to the parent context.
+func (c *sessionContext) Value(key any) any {
+	if _, ok := key.(contextKeyType); ok {
+		return c
+	}
+
+	return c.Context.Value(key)
+}
+
+//nolint:gochecknoglobals // ок for context key
+var (
+	contextKey = contextKeyType{}
+	requestID  uint64
+)
+
+// sessionLiveFlag returns the liveness flag of the session in the context, nil if there is no session.
+func sessionLiveFlag(ctx context.Context) *uint32 {
+	if c := sessionOf(ctx); c != nil {
+		return &c.session.live
+	}
+
+	return nil
+}
+
+// sessionOf returns the context of the session, nil if there is no session in the context.
+func sessionOf(ctx context.Context) *sessionContext {
+	c, _ := ctx.Value(contextKey).(*sessionContext)
+
+	return c
+}
+
+// fromContext returns the key from the context.
+func fromContext(ctx context.Context) uint64 {
+	v, err := sessionFromContext(ctx)
+	if err != nil {
+		panic("no reqcache key in context")
+	}
+
+	return v
+}
+
+// sessionFromContext returns the key from the context or ErrNoSessionInContext.
+func sessionFromContext(ctx context.Context) (uint64, error) {
+	if ctx == nil {
+		return 0, ErrNoSessionInContext
+	}
+
+	c, ok := ctx.Value(contextKey).(*sessionContext)
+	if !ok {
+		return 0, ErrNoSessionInContext
+	}
+
+	return c.session.id, nil
+}
+
+// keyString converts the data key to a string for logging.
+func keyString[K comparable](k K) string {
+	if s, ok := any(k).(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprint(k)
 }
@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
@@ -23,6 +27,11 @@ type mockLogger struct {
 	cacheHit  int
 	cacheMiss int
 
+	leakWarnings []int
+	slowFetches  []string
+	evictions    []string
+	bigKeys      []string
+
 	mu sync.Mutex
 }
 
@@ -50,6 +59,80 @@ func (m *mockLogger) LogCacheHitRatio(_ context.Context, name string, hit bool)
 	}
 }
 
+func (m *mockLogger) LogSessionLeakWarning(_ context.Context, name string, live int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.name = name
+	m.leakWarnings = append(m.leakWarnings, live)
+}
+
+func (m *mockLogger) LogSlowFetch(_ context.Context, name string, key string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.name = name
+	m.slowFetches = append(m.slowFetches, key)
+}
+
+func (m *mockLogger) LogCacheEviction(_ context.Context, name string, evictedKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.name = name
+	m.evictions = append(m.evictions, evictedKey)
+}
+
+func (m *mockLogger) LogOversizedKey(_ context.Context, name string, key string, _ int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.name = name
+	m.bigKeys = append(m.bigKeys, key)
+}
+
+// hookLogger additionally implements IFetchLogger, ISessionLogger and ISessionEntriesObserver.
+type hookLogger struct {
+	mockLogger
+
+	fetches   []string
+	fetchErrs int
+	starts    int
+	ends      []EndStats
+	entries   []int
+}
+
+func (m *hookLogger) LogFetch(_ context.Context, _ string, key string, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fetches = append(m.fetches, key)
+	if err != nil {
+		m.fetchErrs++
+	}
+}
+
+func (m *hookLogger) LogSessionStart(context.Context, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.starts++
+}
+
+func (m *hookLogger) LogSessionEnd(_ context.Context, _ string, stats EndStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ends = append(m.ends, stats)
+}
+
+func (m *hookLogger) ObserveSessionEntries(_ context.Context, _ string, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = append(m.entries, count)
+}
+
 type reqCacheTestObject struct {
 	value int
 }
@@ -66,6 +149,47 @@ func TestSession(t *testing.T) {
 	}, "context already has a reqcache key")
 }
 
+func TestSessionNamespaced(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](10, 10)
+
+	_, err := NewSessionNamespaced(context.Background(), "")
+	require.ErrorIs(t, err, ErrEmptyNamespace)
+
+	ctx1, err := NewSessionNamespaced(context.Background(), "tenant1")
+	require.NoError(t, err)
+	defer cache.EndSession(ctx1)
+
+	ctx2, err := NewSessionNamespaced(context.Background(), "tenant2")
+	require.NoError(t, err)
+	defer cache.EndSession(ctx2)
+
+	require.Equal(t, "tenant1", SessionNamespace(ctx1))
+	require.Equal(t, "tenant2", SessionNamespace(ctx2))
+	require.Empty(t, SessionNamespace(NewSession(context.Background())))
+
+	_, err = NewSessionNamespaced(ctx1, "tenant3")
+	require.ErrorIs(t, err, ErrSessionAlreadyStarted)
+
+	// Sessions of different namespaces don't see each other's entries
+	const key = "key1"
+	require.NoError(t, cache.Put(ctx1, key, &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx2, key, &reqCacheTestObject{value: 2}))
+
+	v, ok := cache.Get(ctx1, key)
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	v, ok = cache.Get(ctx2, key)
+	require.True(t, ok)
+	require.Equal(t, 2, v.value)
+
+	cache.EndSession(ctx2)
+	require.False(t, cache.Exists(ctx2, key))
+	require.True(t, cache.Exists(ctx1, key))
+}
+
 func TestInContext(t *testing.T) {
 	t.Parallel()
 
@@ -96,7 +220,7 @@ func TestReqCache_Exists(t *testing.T) {
 
 	const key = "key1"
 	value := &reqCacheTestObject{value: 100}
-	cache.Put(ctx, key, value)
+	require.NoError(t, cache.Put(ctx, key, value))
 
 	require.True(t, cache.Exists(ctx, key))
 	require.False(t, cache.Exists(ctx, "key2"))
@@ -110,7 +234,7 @@ func TestReqCache_PutAndGet(t *testing.T) {
 
 	const key = "key1"
 	value := &reqCacheTestObject{value: 100}
-	cache.Put(ctx, key, value)
+	require.NoError(t, cache.Put(ctx, key, value))
 
 	retrievedValue, ok := cache.Get(ctx, key)
 	require.True(t, ok)
@@ -126,6 +250,33 @@ func TestReqCache_PutAndGet(t *testing.T) {
 	require.False(t, cache.Exists(ctx, key))
 }
 
+func TestReqCache_RejectNil(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+
+	// By default, nil values are cached
+	cache := New[string, reqCacheTestObject](10, 10)
+	require.NoError(t, cache.Put(ctx, "key1", nil))
+	v, ok := cache.Get(ctx, "key1")
+	require.True(t, ok)
+	require.Nil(t, v)
+
+	cache = New[string, reqCacheTestObject](10, 10, WithRejectNil())
+	require.ErrorIs(t, cache.Put(ctx, "key1", nil), ErrNilValue)
+	require.False(t, cache.Exists(ctx, "key1"))
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{}))
+	require.True(t, cache.Exists(ctx, "key1"))
+
+	// Nil values returned by the fetcher are rejected too
+	_, err := cache.GetOrFetch(ctx, "key2", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, nil
+	})
+	require.ErrorIs(t, err, ErrNilValue)
+	require.False(t, cache.Exists(ctx, "key2"))
+}
+
 func TestReqCache_Delete(t *testing.T) {
 	t.Parallel()
 
@@ -134,7 +285,7 @@ func TestReqCache_Delete(t *testing.T) {
 
 	key := "key1"
 	value := &reqCacheTestObject{value: 100}
-	cache.Put(ctx, key, value)
+	require.NoError(t, cache.Put(ctx, key, value))
 
 	retrievedValue, ok := cache.Get(ctx, key)
 	require.True(t, ok)
@@ -168,7 +319,9 @@ func TestNewObject(t *testing.T) {
 
 	// Ensure that the object pool is reset after clearing the cache
 	cache.EndSession(ctx)
-	require.Empty(t, cache.objects, "Object pool should be empty after cache is cleared")
+	for _, shard := range cache.objectShards {
+		require.Empty(t, shard.objects, "Object pool should be empty after cache is cleared")
+	}
 }
 
 func TestReqCache_GetOrFetch(t *testing.T) {
@@ -210,139 +363,1930 @@ func TestReqCache_GetOrFetch(t *testing.T) {
 	require.Error(t, err)
 }
 
-func TestReqCache_GetOrNew(t *testing.T) {
+func TestReqCache_GetOrFetchWithSource(t *testing.T) {
 	t.Parallel()
 
 	ctx := NewSession(context.Background())
 	cache := New[string, reqCacheTestObject](10, 10)
 
 	const key = "key1"
-	initialValue := 100
+	value := &reqCacheTestObject{value: 100}
 
-	// Prepare function that sets the value
-	prepare := func(_ context.Context, obj *reqCacheTestObject) error {
-		obj.value = initialValue
-		return nil
+	fetches := 0
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		fetches++
+		return value, nil
 	}
 
-	retrievedValue, err := cache.GetOrNew(ctx, key, prepare)
+	// First call goes to the fetcher
+	retrievedValue, fromCache, err := cache.GetOrFetchWithSource(ctx, key, fetcher)
 	require.NoError(t, err)
-	require.Equal(t, initialValue, retrievedValue.value)
+	require.False(t, fromCache)
+	require.Equal(t, value, retrievedValue)
+	require.Equal(t, 1, fetches)
 
-	// Ensure value is correctly stored in the cache
-	cachedValue, ok := cache.Get(ctx, key)
-	require.True(t, ok)
-	require.Equal(t, initialValue, cachedValue.value)
+	// Second call is served from the cache
+	retrievedValue, fromCache, err = cache.GetOrFetchWithSource(ctx, key, fetcher)
+	require.NoError(t, err)
+	require.True(t, fromCache)
+	require.Equal(t, value, retrievedValue)
+	require.Equal(t, 1, fetches)
 
-	// Validate that prepare is not called again and the cached value is returned
-	newPrepare := func(_ context.Context, obj *reqCacheTestObject) error {
-		obj.value = 200
-		return nil
+	// Fetcher error is not reported as a cache hit
+	_, fromCache, err = cache.GetOrFetchWithSource(ctx, "key2",
+		func(context.Context) (*reqCacheTestObject, error) {
+			return nil, errors.New("fetcher error")
+		})
+	require.Error(t, err)
+	require.False(t, fromCache)
+}
+
+func TestReqCache_GetOrFetchAlias(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10)
+
+	value := &reqCacheTestObject{value: 100}
+
+	fetches := 0
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		fetches++
+		return value, nil
 	}
 
-	newValue, err := cache.GetOrNew(ctx, key, newPrepare)
+	_, err := cache.GetOrFetchAlias(ctx, nil, fetcher)
+	require.ErrorIs(t, err, ErrNoKeys)
+
+	// The fetch populates all aliases
+	v, err := cache.GetOrFetchAlias(ctx, []string{"id:1", "slug:one"}, fetcher)
 	require.NoError(t, err)
-	require.Equal(t, initialValue, newValue.value)
+	require.Same(t, value, v)
+	require.Equal(t, 1, fetches)
 
-	// Ensure that error is returned if prepare returns an error
-	_, err = cache.GetOrNew(ctx, "key2", func(context.Context, *reqCacheTestObject) error {
-		return errors.New("prepare error")
-	})
+	for _, key := range []string{"id:1", "slug:one"} {
+		v, ok := cache.Get(ctx, key)
+		require.True(t, ok)
+		require.Same(t, value, v)
+	}
+
+	// Any alias hits without fetching
+	v, err = cache.GetOrFetchAlias(ctx, []string{"uuid:abc", "slug:one"}, fetcher)
+	require.NoError(t, err)
+	require.Same(t, value, v)
+	require.Equal(t, 1, fetches)
+
+	// Fetcher error is returned and nothing is cached
+	_, err = cache.GetOrFetchAlias(ctx, []string{"id:2", "slug:two"},
+		func(context.Context) (*reqCacheTestObject, error) {
+			return nil, errors.New("fetcher error")
+		})
 	require.Error(t, err)
+	require.False(t, cache.Exists(ctx, "id:2"))
 }
 
-func TestReqCache_HitRatio(t *testing.T) {
+func TestReqCache_FetchFailureCaching(t *testing.T) {
 	t.Parallel()
 
 	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10, WithFetchFailureCaching(time.Hour))
 
-	logger := &mockLogger{}
-	cache := New[string, reqCacheTestObject](0, 1, WithLogger("test", logger))
+	errFetch := errors.New("fetcher error")
+	fetches := 0
+	failingFetcher := func(context.Context) (*reqCacheTestObject, error) {
+		fetches++
+		return nil, errFetch
+	}
 
-	const key = "key1"
-	value := &reqCacheTestObject{value: 100}
-	cache.Put(ctx, key, value)
+	_, err := cache.GetOrFetch(ctx, "key1", failingFetcher)
+	require.ErrorIs(t, err, errFetch)
+	require.Equal(t, 1, fetches)
+
+	// The error is returned without calling the fetcher again
+	_, err = cache.GetOrFetch(ctx, "key1", failingFetcher)
+	require.ErrorIs(t, err, errFetch)
+	require.Equal(t, 1, fetches)
+
+	// Other keys are not affected
+	_, err = cache.GetOrFetch(ctx, "key2", failingFetcher)
+	require.ErrorIs(t, err, errFetch)
+	require.Equal(t, 2, fetches)
+
+	// Nor are other sessions
+	ctx2 := NewSession(context.Background())
+	defer cache.EndSession(ctx2)
+	_, err = cache.GetOrFetch(ctx2, "key1", failingFetcher)
+	require.ErrorIs(t, err, errFetch)
+	require.Equal(t, 3, fetches)
+
+	// Errors are forgotten at the session end
+	require.NoError(t, cache.EndSession(ctx))
+	_, err = cache.GetOrFetch(ctx, "key1", failingFetcher)
+	require.ErrorIs(t, err, errFetch)
+	require.Equal(t, 4, fetches)
+}
 
-	// Ensure that we get object from the cache
-	retrievedValue, ok := cache.Get(ctx, key)
-	require.True(t, ok)
-	require.Equal(t, value, retrievedValue)
-	require.Equal(t, &mockLogger{name: "test", objHit: 0, objMiss: 0, cacheHit: 1, cacheMiss: 0}, logger)
+func TestReqCache_FetchFailureExpiration(t *testing.T) {
+	t.Parallel()
 
-	// Not found in the cache
-	_, ok = cache.Get(ctx, "key2")
-	require.False(t, ok)
-	require.Equal(t, &mockLogger{name: "test", objHit: 0, objMiss: 0, cacheHit: 1, cacheMiss: 1}, logger)
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10, WithFetchFailureCaching(time.Millisecond))
+	defer cache.EndSession(ctx)
+
+	_, err := cache.GetOrFetch(ctx, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, errors.New("fetcher error")
+	})
+	require.Error(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	// The error has expired, so the fetcher is called again
+	v, err := cache.GetOrFetch(ctx, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: 1}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, v.value)
 }
 
-func TestAsyncReqCache(t *testing.T) {
+func TestReqCache_FetchFailureCachingContextError(t *testing.T) {
 	t.Parallel()
 
-	const (
-		nParallel = 100
-		objCount  = 1000
-	)
+	cache := New[string, reqCacheTestObject](10, 10, WithFetchFailureCaching(time.Hour),
+		WithFetchRetry(2, func(int) time.Duration { return time.Hour }))
+
+	ctx, cancel := context.WithCancel(NewSession(context.Background()))
+
+	// The context is canceled during the retry backoff
+	_, err := cache.GetOrFetch(ctx, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		cancel()
+		return nil, errors.New("fetcher error")
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	state := cache.trackSession(ctx, fromContext(ctx))
+	state.mu.Lock()
+	require.Empty(t, state.extras().fetchFailures)
+	state.mu.Unlock()
+	require.NoError(t, cache.EndSession(ctx))
+
+	// A context error returned by the fetcher isn't remembered either
+	noRetry := New[string, reqCacheTestObject](10, 10, WithFetchFailureCaching(time.Hour))
+	ctx2 := NewSession(context.Background())
+	defer noRetry.EndSession(ctx2)
+	_, err = noRetry.GetOrFetch(ctx2, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, fmt.Errorf("query: %w", context.DeadlineExceeded)
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The error isn't cached, so the fetcher is called again
+	v, err := noRetry.GetOrFetch(ctx2, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: 1}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, v.value)
+}
+
+func TestReqCache_GetOrFetchShared(t *testing.T) {
+	t.Parallel()
+
+	const nParallel = 5
+
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10)
 
 	var (
+		fetches  int32
+		started  = make(chan struct{})
+		release  = make(chan struct{})
 		errGroup errgroup.Group
-		cache    = New[string, reqCacheTestObject](objCount, objCount)
 	)
 
-	// Ensure that we can work with multiple threads without interference between them
-	for i := 0; i < nParallel; i++ {
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return &reqCacheTestObject{value: 1}, nil
+	}
+
+	results := make([]*reqCacheTestObject, nParallel)
+	errGroup.Go(func() error {
+		var err error
+		results[0], err = cache.GetOrFetch(ctx, "key", fetcher)
+		return err
+	})
+
+	<-started
+	for i := 1; i < nParallel; i++ {
+		i := i
 		errGroup.Go(func() error {
-			ctx := NewSession(context.Background())
-			defer cache.EndSession(ctx)
+			var err error
+			results[i], err = cache.GetOrFetch(ctx, "key", fetcher)
+			return err
+		})
+	}
 
-			objects := make([]*reqCacheTestObject, objCount)
+	// Give the other calls time to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
 
-			for k := 0; k < objCount; k++ {
-				key := "key" + strconv.Itoa(k)
-				obj := cache.NewObject(ctx)
-				obj.value = k
-				cache.Put(ctx, key, obj)
-				objects[k] = obj
-			}
+	require.NoError(t, errGroup.Wait())
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	for _, res := range results {
+		require.Same(t, results[0], res)
+	}
 
-			for k := 0; k < objCount; k++ {
-				key := "key" + strconv.Itoa(k)
-				v, ok := cache.Get(ctx, key)
-				if !ok {
-					return fmt.Errorf("value not found, expected %d", k)
-				}
+	// The flights are forgotten at the session end
+	require.NoError(t, cache.EndSession(ctx))
+	require.Empty(t, cache.SessionsSnapshot())
+}
 
-				if v.value != k {
-					return fmt.Errorf("value mismatch, expected %d, got %d", k, v.value)
-				}
+func TestReqCache_GetOrFetchSharedWaiterCanceled(t *testing.T) {
+	t.Parallel()
 
-				if v != objects[k] {
-					return fmt.Errorf("object mismatch, expected %p, got %p", objects[k], v)
-				}
-			}
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10)
+	defer cache.EndSession(ctx)
 
-			reqID := fromContext(ctx)
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		errGroup errgroup.Group
+	)
 
-			cache.muData.RLock()
-			defer cache.muData.RUnlock()
-			cacheLen := cache.data[reqID].Len()
-			if cacheLen != objCount {
-				return fmt.Errorf("data cache length mismatch, expected %d, got %d", objCount, cacheLen)
-			}
+	errGroup.Go(func() error {
+		_, err := cache.GetOrFetch(ctx, "key", func(context.Context) (*reqCacheTestObject, error) {
+			close(started)
+			<-release
+			return &reqCacheTestObject{value: 1}, nil
+		})
+		return err
+	})
 
-			cache.muObjects.Lock()
-			defer cache.muObjects.Unlock()
-			objectsLen := cache.objects[reqID].index
-			if objectsLen != objCount {
-				return fmt.Errorf("pool length mismatch, expected %d, got %d", objCount, objectsLen)
-			}
+	<-started
 
-			return nil
+	// The waiter stops waiting for the shared call when its context ends
+	waiterCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := cache.GetOrFetch(waiterCtx, "key", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, errors.New("unexpected fetch")
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The shared call isn't affected
+	close(release)
+	require.NoError(t, errGroup.Wait())
+	v, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+}
+
+func TestReqCache_GetOrFetchSharedDistinctKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+	type item struct{ id int }
+
+	cache := New[*item, reqCacheTestObject](10, 10)
+	defer cache.EndSession(ctx)
+
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		errGroup errgroup.Group
+	)
+
+	// The pointers are formatted the same way, but they are different keys, so the fetches must not be shared
+	errGroup.Go(func() error {
+		_, err := cache.GetOrFetch(ctx, &item{id: 1}, func(context.Context) (*reqCacheTestObject, error) {
+			close(started)
+			<-release
+			return &reqCacheTestObject{value: 1}, nil
 		})
-	}
+		return err
+	})
+
+	<-started
+	v, err := cache.GetOrFetch(ctx, &item{id: 1}, func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: 2}, nil
+	})
+	close(release)
 
+	require.NoError(t, err)
+	require.Equal(t, 2, v.value)
 	require.NoError(t, errGroup.Wait())
+}
 
-	// Ensure that the object pool is empty after all goroutines are done
-	require.Empty(t, cache.objects, "Object pool should be empty after all goroutines are done")
-	require.Empty(t, cache.data, "Data cache should be empty after all goroutines are done")
+func TestReqCache_FetchKeyNormalizer(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10, WithFetchKeyNormalizer(strings.ToLower))
+	defer cache.EndSession(ctx)
+
+	var (
+		fetches  int32
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		errGroup errgroup.Group
+	)
+
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return &reqCacheTestObject{value: 1}, nil
+	}
+
+	results := make([]*reqCacheTestObject, 2)
+	errGroup.Go(func() error {
+		var err error
+		results[0], err = cache.GetOrFetch(ctx, "User", fetcher)
+		return err
+	})
+
+	<-started
+	errGroup.Go(func() error {
+		var err error
+		results[1], err = cache.GetOrFetch(ctx, "user", fetcher)
+		return err
+	})
+
+	// Give the second call time to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	require.NoError(t, errGroup.Wait())
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	require.Same(t, results[0], results[1])
+
+	// The result is cached under both original keys
+	require.True(t, cache.Exists(ctx, "User"))
+	require.True(t, cache.Exists(ctx, "user"))
+	require.False(t, cache.Exists(ctx, "USER"))
+}
+
+func TestReqCache_FetchKeyNormalizerTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() {
+		New[int, reqCacheTestObject](1, 1, WithFetchKeyNormalizer(strings.ToLower))
+	})
+}
+
+func TestReqCache_FetchKeyNormalizerPanic(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10, WithFetchKeyNormalizer(strings.ToLower))
+	defer cache.EndSession(ctx)
+
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		errGroup errgroup.Group
+		errs     [2]error
+	)
+
+	errGroup.Go(func() error {
+		_, errs[0] = cache.GetOrFetch(ctx, "User", func(context.Context) (*reqCacheTestObject, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+		return nil
+	})
+
+	<-started
+	errGroup.Go(func() error {
+		_, errs[1] = cache.GetOrFetch(ctx, "user", func(context.Context) (*reqCacheTestObject, error) {
+			return &reqCacheTestObject{value: 1}, nil
+		})
+		return nil
+	})
+
+	// Give the second call time to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	require.NoError(t, errGroup.Wait())
+	require.ErrorIs(t, errs[0], ErrFetcherPanicked)
+	require.ErrorContains(t, errs[0], "boom")
+	require.ErrorIs(t, errs[1], ErrFetcherPanicked)
+
+	// The key isn't wedged, the next call fetches again
+	v, err := cache.GetOrFetch(ctx, "USER", func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: 2}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, v.value)
+}
+
+func TestReqCache_RefreshIfOlderThan(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New[string, reqCacheTestObject](0, 10, WithClock(func() time.Time { return now }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	var fetches int
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		fetches++
+		return &reqCacheTestObject{value: fetches}, nil
+	}
+
+	// Absent data is fetched
+	v, err := cache.RefreshIfOlderThan(ctx, "key", time.Minute, fetcher)
+	require.NoError(t, err)
+	require.Equal(t, 1, v.value)
+
+	// Fresh enough data is taken from the cache
+	now = now.Add(time.Minute)
+	v, err = cache.RefreshIfOlderThan(ctx, "key", time.Minute, fetcher)
+	require.NoError(t, err)
+	require.Equal(t, 1, v.value)
+	require.Equal(t, 1, fetches)
+
+	// Too old data is refetched
+	now = now.Add(time.Second)
+	v, err = cache.RefreshIfOlderThan(ctx, "key", time.Minute, fetcher)
+	require.NoError(t, err)
+	require.Equal(t, 2, v.value)
+
+	cached, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Same(t, v, cached)
+
+	// Data of unknown age is refetched
+	require.NoError(t, cache.Put(ctx, "other", &reqCacheTestObject{value: 100}))
+	v, err = cache.RefreshIfOlderThan(ctx, "other", time.Hour, fetcher)
+	require.NoError(t, err)
+	require.Equal(t, 3, v.value)
+
+	// Fresh data that was deleted is refetched
+	require.True(t, cache.Delete(ctx, "other"))
+	v, err = cache.RefreshIfOlderThan(ctx, "other", time.Hour, fetcher)
+	require.NoError(t, err)
+	require.Equal(t, 4, v.value)
+}
+
+func TestReqCache_GetOrNew(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+	cache := New[string, reqCacheTestObject](10, 10)
+
+	const key = "key1"
+	initialValue := 100
+
+	// Prepare function that sets the value
+	prepare := func(_ context.Context, obj *reqCacheTestObject) error {
+		obj.value = initialValue
+		return nil
+	}
+
+	retrievedValue, err := cache.GetOrNew(ctx, key, prepare)
+	require.NoError(t, err)
+	require.Equal(t, initialValue, retrievedValue.value)
+
+	// Ensure value is correctly stored in the cache
+	cachedValue, ok := cache.Get(ctx, key)
+	require.True(t, ok)
+	require.Equal(t, initialValue, cachedValue.value)
+
+	// Validate that prepare is not called again and the cached value is returned
+	newPrepare := func(_ context.Context, obj *reqCacheTestObject) error {
+		obj.value = 200
+		return nil
+	}
+
+	newValue, err := cache.GetOrNew(ctx, key, newPrepare)
+	require.NoError(t, err)
+	require.Equal(t, initialValue, newValue.value)
+
+	// Ensure that error is returned if prepare returns an error
+	_, err = cache.GetOrNew(ctx, "key2", func(context.Context, *reqCacheTestObject) error {
+		return errors.New("prepare error")
+	})
+	require.Error(t, err)
+}
+
+func TestReqCache_HitRatio(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewSession(context.Background())
+
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](0, 1, WithLogger("test", logger))
+
+	const key = "key1"
+	value := &reqCacheTestObject{value: 100}
+	require.NoError(t, cache.Put(ctx, key, value))
+
+	// Ensure that we get object from the cache
+	retrievedValue, ok := cache.Get(ctx, key)
+	require.True(t, ok)
+	require.Equal(t, value, retrievedValue)
+	require.Equal(t, &mockLogger{name: "test", objHit: 0, objMiss: 0, cacheHit: 1, cacheMiss: 0}, logger)
+
+	// Not found in the cache
+	_, ok = cache.Get(ctx, "key2")
+	require.False(t, ok)
+	require.Equal(t, &mockLogger{name: "test", objHit: 0, objMiss: 0, cacheHit: 1, cacheMiss: 1}, logger)
+}
+
+func TestReqCache_LeakThreshold(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](1, 1, WithLogger("test", logger), WithLeakThreshold(2))
+
+	// Sessions within the threshold don't trigger the warning
+	ctx1 := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx1, "key", &reqCacheTestObject{}))
+	ctx2 := NewSession(context.Background())
+	cache.NewObject(ctx2)
+	require.Empty(t, logger.leakWarnings)
+
+	// Crossing the threshold triggers the warning
+	ctx3 := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx3, "key", &reqCacheTestObject{}))
+	require.Equal(t, []int{3}, logger.leakWarnings)
+
+	// Warnings are rate-limited
+	ctx4 := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx4, "key", &reqCacheTestObject{}))
+	require.Equal(t, []int{3}, logger.leakWarnings)
+
+	for _, ctx := range []context.Context{ctx1, ctx2, ctx3, ctx4} {
+		cache.EndSession(ctx)
+	}
+	require.Empty(t, cache.SessionsSnapshot(), "Sessions should be untracked after EndSession")
+}
+
+func TestReqCache_SlowFetch(t *testing.T) {
+	t.Parallel()
+
+	const threshold = 20 * time.Millisecond
+
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](1, 10, WithLogger("test", logger), WithSlowFetchThreshold(threshold))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// Fast fetcher is not reported
+	_, err := cache.GetOrFetch(ctx, "fast", func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{}, nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, logger.slowFetches)
+
+	// Slow fetcher is reported with its key
+	_, err = cache.GetOrFetch(ctx, "slow", func(context.Context) (*reqCacheTestObject, error) {
+		time.Sleep(2 * threshold)
+		return &reqCacheTestObject{}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"slow"}, logger.slowFetches)
+}
+
+func TestReqCache_EndSessionStats(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](2, 10)
+
+	_, err := cache.EndSessionStats(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+
+	for i := 0; i < 3; i++ {
+		cache.Put(ctx, "key"+strconv.Itoa(i), cache.NewObject(ctx))
+	}
+
+	stats, err := cache.EndSessionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, EndStats{Entries: 3, PooledObjectsUsed: 2, OverflowObjects: 1}, stats)
+
+	// The session is already finished
+	stats, err = cache.EndSessionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, EndStats{}, stats)
+}
+
+func TestReqCache_Len(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 3)
+
+	_, err := cache.Len(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	n, err := cache.Len(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	for i, want := range []int{1, 2, 3, 3, 3} {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+		n, err = cache.Len(ctx)
+		require.NoError(t, err)
+		require.Equal(t, want, n, "Evicted entries must not be counted")
+	}
+
+	cache.Delete(ctx, 4)
+	n, err = cache.Len(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestReqCache_KeysIntoLRU(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](1, 2)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{}))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{}))
+	require.NoError(t, cache.Put(ctx, "key3", &reqCacheTestObject{}))
+
+	keys, err := cache.KeysInto(ctx, []string{"prefix"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"prefix", "key2", "key3"}, keys)
+}
+
+func TestReqCache_ForceEndSession(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](10, 10)
+
+	ctx := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx, "key1", cache.NewObject(ctx)))
+
+	sessionID, err := SessionID(ctx)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, cache.ForceEndSession(0), ErrInvalidSessionID)
+
+	// Unknown id is a no-op
+	require.NoError(t, cache.ForceEndSession(sessionID+1000))
+	require.True(t, cache.Exists(ctx, "key1"))
+
+	require.NoError(t, cache.ForceEndSession(sessionID))
+	require.False(t, cache.Exists(ctx, "key1"))
+	for _, shard := range cache.objectShards {
+		require.Empty(t, shard.objects)
+	}
+	require.Empty(t, cache.SessionsSnapshot())
+
+	// Double end is a no-op
+	require.NoError(t, cache.ForceEndSession(sessionID))
+	cache.EndSession(ctx)
+}
+
+func TestReqCache_EvictionLogging(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](1, 2, WithLogger("test", logger))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{}))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{}))
+	require.True(t, cache.Delete(ctx, "key2"))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{}))
+	require.Empty(t, logger.evictions, "Deletion and insertion within the capacity are not evictions")
+
+	// Inserting beyond the capacity evicts the oldest key
+	require.NoError(t, cache.Put(ctx, "key3", &reqCacheTestObject{}))
+	require.Equal(t, []string{"key1"}, logger.evictions)
+
+	// Evictions are rate-limited
+	require.NoError(t, cache.Put(ctx, "key4", &reqCacheTestObject{}))
+	require.Equal(t, []string{"key1"}, logger.evictions)
+}
+
+func TestReqCache_HitRatioWithoutLogger(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+	require.Zero(t, cache.HitRatio())
+
+	ctx1 := NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx1, "key1", &reqCacheTestObject{}))
+
+	// 2 hits, 1 miss
+	_, ok := cache.Get(ctx1, "key1")
+	require.True(t, ok)
+	require.True(t, cache.Exists(ctx1, "key1"))
+	require.False(t, cache.Exists(ctx1, "key2"))
+	require.InDelta(t, 2.0/3.0, cache.HitRatio(), 1e-9)
+
+	// The ratio is global across sessions: 2 hits, 2 misses
+	cache.EndSession(ctx1)
+	ctx2 := NewSession(context.Background())
+	defer cache.EndSession(ctx2)
+
+	_, ok = cache.Get(ctx2, "key1")
+	require.False(t, ok)
+	require.InDelta(t, 0.5, cache.HitRatio(), 1e-9)
+}
+
+func TestReqCache_WithoutEviction(t *testing.T) {
+	t.Parallel()
+
+	const cacheSize = 2
+
+	cache := New[string, reqCacheTestObject](0, cacheSize)
+
+	require.ErrorIs(t, cache.WithoutEviction(context.Background(), func() error { return nil }), ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	keys := []string{"key1", "key2", "key3", "key4", "key5"}
+
+	err := cache.WithoutEviction(ctx, func() error {
+		for _, key := range keys {
+			if err := cache.Put(ctx, key, &reqCacheTestObject{}); err != nil {
+				return err
+			}
+		}
+
+		// All entries are present during the bulk load
+		cached, err := cache.KeysInto(ctx, nil)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, keys, cached)
+
+		return errors.New("fn error")
+	})
+	require.EqualError(t, err, "fn error")
+
+	// The cache is trimmed to the capacity afterwards
+	cached, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"key4", "key5"}, cached)
+
+	// The capacity is restored
+	require.NoError(t, cache.Put(ctx, "key6", &reqCacheTestObject{}))
+	cached, err = cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"key5", "key6"}, cached)
+
+	// Backends without Resizer are not supported
+	cache = New[string, reqCacheTestObject](0, cacheSize, WithBackendFactory(newMapBackend[string, reqCacheTestObject]))
+	require.ErrorIs(t, cache.WithoutEviction(ctx, func() error { return nil }), ErrResizeNotSupported)
+}
+
+func TestReqCache_Peek(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[int, reqCacheTestObject](0, 2, WithLogger("test", logger))
+
+	_, _, err := cache.Peek(context.Background(), 1)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx, 2, &reqCacheTestObject{value: 2}))
+
+	v, found, err := cache.Peek(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 1, v.value)
+
+	_, found, err = cache.Peek(ctx, 3)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.Equal(t, 1, logger.cacheHit)
+	require.Equal(t, 1, logger.cacheMiss)
+
+	// 1 is still the oldest entry and is evicted
+	require.NoError(t, cache.Put(ctx, 3, &reqCacheTestObject{value: 3}))
+	require.False(t, cache.Exists(ctx, 1))
+	require.True(t, cache.Exists(ctx, 2))
+}
+
+func TestReqCache_Range(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10)
+
+	require.ErrorIs(t, cache.Range(context.Background(), func(int, *reqCacheTestObject) bool { return true }),
+		ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+	_, _ = cache.Get(ctx, 1) // 1 becomes the newest
+
+	var keys []int
+	require.NoError(t, cache.Range(ctx, func(k int, v *reqCacheTestObject) bool {
+		require.Equal(t, k, v.value)
+		keys = append(keys, k)
+
+		// The cache can be used inside the callback
+		_, found := cache.Get(ctx, k)
+		require.True(t, found)
+		cache.Delete(ctx, k)
+
+		return true
+	}))
+	require.Equal(t, []int{2, 3, 4, 1}, keys)
+
+	n, err := cache.Len(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// Stopping early
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+	keys = nil
+	require.NoError(t, cache.Range(ctx, func(k int, _ *reqCacheTestObject) bool {
+		keys = append(keys, k)
+		return k < 2
+	}))
+	require.Equal(t, []int{1, 2}, keys)
+}
+
+func TestReqCache_Filter(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 3)
+
+	_, err := cache.Filter(context.Background(), func(string, *reqCacheTestObject) bool { return true })
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	values := map[string]*reqCacheTestObject{
+		"key1": {value: 1},
+		"key2": {value: 2},
+		"key3": {value: 3},
+	}
+	for _, key := range []string{"key1", "key2", "key3"} {
+		require.NoError(t, cache.Put(ctx, key, values[key]))
+	}
+
+	res, err := cache.Filter(ctx, func(key string, v *reqCacheTestObject) bool {
+		return key == "key1" || v.value == 3
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]*reqCacheTestObject{"key1": values["key1"], "key3": values["key3"]}, res)
+
+	// The recency is not updated, so key1 is still the oldest entry
+	require.NoError(t, cache.Put(ctx, "key4", &reqCacheTestObject{}))
+	require.False(t, cache.Exists(ctx, "key1"))
+}
+
+func TestReqCache_Sorted(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 5)
+
+	_, err := cache.Sorted(context.Background(), func(a, b *reqCacheTestObject) bool { return a.value < b.value })
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	for key, value := range map[string]int{"a": 3, "b": 1, "c": 2, "d": 5, "e": 4} {
+		require.NoError(t, cache.Put(ctx, key, &reqCacheTestObject{value: value}))
+	}
+
+	res, err := cache.Sorted(ctx, func(a, b *reqCacheTestObject) bool { return a.value > b.value })
+	require.NoError(t, err)
+
+	values := make([]int, 0, len(res))
+	for _, v := range res {
+		values = append(values, v.value)
+	}
+	require.Equal(t, []int{5, 4, 3, 2, 1}, values)
+}
+
+type tenantContextKey struct{}
+
+func TestReqCache_ContextKeyPrefix(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10, WithContextKeyPrefix[string](func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantContextKey{}).(string)
+		return tenant
+	}))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	ctx1 := context.WithValue(ctx, tenantContextKey{}, "tenant1")
+	ctx2 := context.WithValue(ctx, tenantContextKey{}, "tenant2")
+
+	require.NoError(t, cache.Put(ctx1, "key", &reqCacheTestObject{value: 1}))
+	require.False(t, cache.Exists(ctx2, "key"))
+
+	require.NoError(t, cache.Put(ctx2, "key", &reqCacheTestObject{value: 2}))
+
+	v, ok := cache.Get(ctx1, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	v, err := cache.GetOrFetch(ctx2, "key", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, errors.New("unexpected fetch")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, v.value)
+
+	require.True(t, cache.Delete(ctx1, "key"))
+	require.False(t, cache.Exists(ctx1, "key"))
+	require.True(t, cache.Exists(ctx2, "key"))
+
+	require.Panics(t, func() {
+		New[int, reqCacheTestObject](0, 10, WithContextKeyPrefix[string](func(context.Context) string { return "" }))
+	})
+}
+
+func TestReqCache_ObjectByteBudget(t *testing.T) {
+	t.Parallel()
+
+	sizeOf := func() int64 { return int64(unsafe.Sizeof(reqCacheTestObject{})) }
+
+	cache := New[string, reqCacheTestObject](1, 1, WithObjectByteBudget(10*sizeOf()+1, sizeOf))
+	require.Equal(t, 10, cache.objSize)
+
+	ctx := NewSession(context.Background())
+	cache.NewObject(ctx)
+	stats, err := cache.EndSessionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, EndStats{Entries: 0, PooledObjectsUsed: 1, OverflowObjects: 0}, stats)
+
+	require.Panics(t, func() {
+		New[string, reqCacheTestObject](1, 1, WithObjectByteBudget(sizeOf()-1, sizeOf))
+	})
+	require.Panics(t, func() {
+		New[string, reqCacheTestObject](1, 1, WithObjectByteBudget(100, func() int64 { return 0 }))
+	})
+}
+
+func TestReqCache_EvictCallback(t *testing.T) {
+	t.Parallel()
+
+	type ctxKey struct{}
+
+	var evicted []int
+	cache := New[int, reqCacheTestObject](0, 2,
+		WithEvictCallback(func(ctx context.Context, key int, value *reqCacheTestObject) {
+			require.Equal(t, "op", ctx.Value(ctxKey{}), "The context of the operation must be passed")
+			require.Equal(t, key, value.value)
+			evicted = append(evicted, key)
+		}))
+
+	ctx := context.WithValue(NewSession(context.Background()), ctxKey{}, "op")
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+	require.NoError(t, cache.Put(ctx, 2, &reqCacheTestObject{value: 2}))
+	require.NoError(t, cache.Put(ctx, 2, &reqCacheTestObject{value: 2})) // replaced, not evicted
+	cache.Delete(ctx, 2)                                                 // deleted, not evicted
+	require.Empty(t, evicted)
+
+	require.NoError(t, cache.PutMany(ctx, map[int]*reqCacheTestObject{3: {value: 3}}))
+	require.NoError(t, cache.Put(ctx, 4, &reqCacheTestObject{value: 4}))
+	require.Equal(t, []int{1}, evicted)
+
+	require.NoError(t, cache.Put(ctx, 5, &reqCacheTestObject{value: 5}))
+	require.Equal(t, []int{1, 3}, evicted)
+}
+
+func TestReqCache_EvictCallbackTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() {
+		New[string, reqCacheTestObject](1, 1, WithEvictCallback(func(context.Context, int, *reqCacheTestObject) {}))
+	})
+}
+
+func TestReqCache_ValueFinalizer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		finalized = make(map[int]int)
+	)
+	cache := New[int, reqCacheTestObject](0, 2, WithValueFinalizer(func(v *reqCacheTestObject) {
+		mu.Lock()
+		defer mu.Unlock()
+		finalized[v.value]++
+	}))
+	finalizedValues := func() map[int]int {
+		mu.Lock()
+		defer mu.Unlock()
+		res := make(map[int]int, len(finalized))
+		for k, v := range finalized {
+			res[k] = v
+		}
+		return res
+	}
+
+	ctx := NewSession(context.Background())
+
+	// Eviction
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+	require.Equal(t, map[int]int{1: 1}, finalizedValues())
+
+	// Replacement with another value, the same value is not finalized
+	v2, _ := cache.Get(ctx, 2)
+	require.NoError(t, cache.Put(ctx, 2, v2))
+	require.NoError(t, cache.Put(ctx, 2, &reqCacheTestObject{value: 20}))
+	require.Equal(t, map[int]int{1: 1, 2: 1}, finalizedValues())
+
+	// Delete
+	require.True(t, cache.Delete(ctx, 3))
+	require.False(t, cache.Delete(ctx, 3))
+	require.Equal(t, map[int]int{1: 1, 2: 1, 3: 1}, finalizedValues())
+
+	// Restoring the capacity after WithoutEviction
+	require.NoError(t, cache.WithoutEviction(ctx, func() error {
+		for i := 4; i <= 6; i++ {
+			if err := cache.Put(ctx, i, &reqCacheTestObject{value: i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.Equal(t, map[int]int{1: 1, 2: 1, 3: 1, 20: 1, 4: 1}, finalizedValues())
+
+	// The end of the session, the finalizer may use the cache
+	cache.valueFinalizer = func(v *reqCacheTestObject) {
+		require.False(t, cache.Exists(ctx, v.value))
+		mu.Lock()
+		defer mu.Unlock()
+		finalized[v.value]++
+	}
+	require.NoError(t, cache.EndSession(ctx))
+	require.Equal(t, map[int]int{1: 1, 2: 1, 3: 1, 20: 1, 4: 1, 5: 1, 6: 1}, finalizedValues())
+
+	require.Panics(t, func() {
+		New[int, string](0, 2, WithValueFinalizer(func(*reqCacheTestObject) {}))
+	})
+}
+
+func TestReqCache_SetLogger(t *testing.T) {
+	t.Parallel()
+
+	logger1 := &mockLogger{}
+	cache := New[string, reqCacheTestObject](1, 1, WithLogger("test1", logger1))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	cache.Get(ctx, "key")
+	require.Equal(t, &mockLogger{name: "test1", cacheMiss: 1}, logger1)
+
+	// Swapping concurrently with lookups is safe
+	logger2 := &mockLogger{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Get(ctx, "key")
+		}()
+	}
+	cache.SetLogger("test2", logger2)
+	wg.Wait()
+
+	logger1.mu.Lock()
+	logger2.mu.Lock()
+	require.Equal(t, 11, logger1.cacheMiss+logger2.cacheMiss)
+	logger1.mu.Unlock()
+	logger2.mu.Unlock()
+
+	// Subsequent operations use the new logger, including the object pool
+	hits1 := logger1.cacheMiss
+	cache.Get(ctx, "key")
+	cache.NewObject(ctx)
+	cache.NewObject(ctx)
+	require.Equal(t, hits1, logger1.cacheMiss)
+	require.Zero(t, logger1.objHit+logger1.objMiss)
+	require.Equal(t, "test2", logger2.name)
+	require.Equal(t, 1, logger2.objHit)
+	require.Equal(t, 1, logger2.objMiss)
+
+	// Nil disables logging
+	cache.SetLogger("", nil)
+	require.NotPanics(t, func() { cache.Get(ctx, "key") })
+}
+
+func TestReqCache_Move(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	_, err := cache.Move(context.Background(), "a", "b")
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// No session data yet
+	moved, err := cache.Move(ctx, "a", "b")
+	require.NoError(t, err)
+	require.False(t, moved)
+
+	value := &reqCacheTestObject{value: 1}
+	require.NoError(t, cache.Put(ctx, "a", value))
+	require.NoError(t, cache.Put(ctx, "b", &reqCacheTestObject{value: 2}))
+
+	// The existing destination is overwritten
+	moved, err = cache.Move(ctx, "a", "b")
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.False(t, cache.Exists(ctx, "a"))
+	v, ok := cache.Get(ctx, "b")
+	require.True(t, ok)
+	require.Same(t, value, v)
+
+	// No source
+	moved, err = cache.Move(ctx, "a", "c")
+	require.NoError(t, err)
+	require.False(t, moved)
+	require.False(t, cache.Exists(ctx, "c"))
+
+	// The same key
+	moved, err = cache.Move(ctx, "b", "b")
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.True(t, cache.Exists(ctx, "b"))
+}
+
+func TestReqCache_MoveMetadata(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New[string, reqCacheTestObject](0, 10, WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.PutTagged(ctx, "a", &reqCacheTestObject{value: 1}, "tag"))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, cache.Put(ctx, "b", &reqCacheTestObject{value: 2}))
+
+	moved, err := cache.Move(ctx, "a", "b")
+	require.NoError(t, err)
+	require.True(t, moved)
+
+	// The moved data keeps its expiration time instead of the one of the overwritten data
+	now = now.Add(30 * time.Second)
+	require.False(t, cache.Exists(ctx, "b"))
+
+	// And its tags
+	require.NoError(t, cache.PutTagged(ctx, "c", &reqCacheTestObject{value: 3}, "tag"))
+	moved, err = cache.Move(ctx, "c", "d")
+	require.NoError(t, err)
+	require.True(t, moved)
+
+	n, err := cache.InvalidateTag(ctx, "tag")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.False(t, cache.Exists(ctx, "d"))
+
+	// The metadata of the old key is gone
+	requestKey := fromContext(ctx)
+	shard := cache.dataShard(requestKey)
+	shard.mu.RLock()
+	require.Empty(t, shard.data[requestKey].expirations)
+	shard.mu.RUnlock()
+}
+
+func TestReqCache_RefreshIfChanged(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+	equal := func(a, b *reqCacheTestObject) bool { return a.value == b.value }
+
+	var current int
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: current}, nil
+	}
+
+	_, _, err := cache.RefreshIfChanged(context.Background(), "key", fetcher, equal)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// Nothing was cached
+	current = 1
+	v, changed, err := cache.RefreshIfChanged(ctx, "key", fetcher, equal)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, 1, v.value)
+
+	// Unchanged
+	v, changed, err = cache.RefreshIfChanged(ctx, "key", fetcher, equal)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, 1, v.value)
+
+	// Changed
+	current = 2
+	v, changed, err = cache.RefreshIfChanged(ctx, "key", fetcher, equal)
+	require.NoError(t, err)
+	require.True(t, changed)
+	cached, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Same(t, v, cached)
+
+	// The fetcher error keeps the cached data
+	errFetch := errors.New("fetch failed")
+	_, _, err = cache.RefreshIfChanged(ctx, "key", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, errFetch
+	}, equal)
+	require.ErrorIs(t, err, errFetch)
+	cached, ok = cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Same(t, v, cached)
+}
+
+func TestReqCache_FetchAndSessionLogger(t *testing.T) {
+	t.Parallel()
+
+	logger := &hookLogger{}
+	cache := New[string, reqCacheTestObject](1, 10, WithLogger("test", logger))
+
+	// A session that doesn't use the cache is not reported
+	require.NoError(t, cache.EndSession(NewSession(context.Background())))
+	require.Zero(t, logger.starts)
+	require.Empty(t, logger.ends)
+
+	ctx := NewSession(context.Background())
+
+	_, err := cache.GetOrFetch(ctx, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{}, nil
+	})
+	require.NoError(t, err)
+	_, err = cache.GetOrFetch(ctx, "key2", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, errors.New("failed")
+	})
+	require.Error(t, err)
+	_, err = cache.GetOrFetch(ctx, "key1", func(context.Context) (*reqCacheTestObject, error) {
+		return nil, errors.New("unexpected fetch")
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"key1", "key2"}, logger.fetches)
+	require.Equal(t, 1, logger.fetchErrs)
+	require.Equal(t, 1, logger.starts)
+
+	cache.NewObject(ctx)
+	cache.NewObject(ctx)
+	require.NoError(t, cache.EndSession(ctx))
+	require.NoError(t, cache.EndSession(ctx))
+	require.Equal(t, 1, logger.starts)
+	require.Equal(t, []EndStats{{Entries: 1, PooledObjectsUsed: 1, OverflowObjects: 1}}, logger.ends)
+}
+
+func TestReqCache_ObserveSessionEntries(t *testing.T) {
+	t.Parallel()
+
+	logger := &hookLogger{}
+	cache := New[int, reqCacheTestObject](1, 10, WithLogger("test", logger))
+
+	for _, n := range []int{3, 0, 15} {
+		ctx := NewSession(context.Background())
+		cache.NewObject(ctx)
+		for i := 0; i < n; i++ {
+			require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{}))
+		}
+		require.NoError(t, cache.EndSession(ctx))
+	}
+
+	// A session that doesn't use the cache is not observed
+	require.NoError(t, cache.EndSession(NewSession(context.Background())))
+
+	require.Equal(t, []int{3, 0, 10}, logger.entries, "The number of entries is limited by cacheSize")
+}
+
+func TestReqCache_SizeSanity(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() { New[string, reqCacheTestObject](100000, 10, WithSizeSanity(100)) })
+	require.Panics(t, func() { New[string, reqCacheTestObject](10, 100000, WithSizeSanity(100)) })
+	require.NotPanics(t, func() { New[string, reqCacheTestObject](100, 1000, WithSizeSanity(100)) })
+	require.NotPanics(t, func() { New[string, reqCacheTestObject](0, 100000, WithSizeSanity(100)) })
+
+	// Without the option any pair is accepted
+	require.NotPanics(t, func() { New[string, reqCacheTestObject](100000, 10) })
+
+	_, err := Builder[string, reqCacheTestObject]().ObjSize(100000).CacheSize(10).Options(WithSizeSanity(100)).Build()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.Contains(t, err.Error(), "swapped")
+}
+
+func TestReqCache_AutoEndOnEmpty(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](1, 10, WithAutoEndOnEmpty())
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+	requestKey := fromContext(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{}))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{}))
+
+	require.True(t, cache.Delete(ctx, "key1"))
+	require.Contains(t, cache.dataShard(requestKey).data, requestKey, "Storage with entries must not be released")
+
+	require.True(t, cache.Delete(ctx, "key2"))
+	require.NotContains(t, cache.dataShard(requestKey).data, requestKey, "Empty storage must be released")
+	require.NoError(t, cache.CheckInvariants())
+
+	// The storage is created again by the next write
+	require.NoError(t, cache.Put(ctx, "key3", &reqCacheTestObject{value: 3}))
+	v, ok := cache.Get(ctx, "key3")
+	require.True(t, ok)
+	require.Equal(t, 3, v.value)
+
+	// Not released while the session has objects
+	cache.NewObject(ctx)
+	require.True(t, cache.Delete(ctx, "key3"))
+	require.Contains(t, cache.dataShard(requestKey).data, requestKey)
+}
+
+func TestReqCache_KeySizeWarning(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](0, 10, WithLogger("test", logger),
+		WithKeySizeWarning(8, func(k string) int { return len(k) }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "normal", &reqCacheTestObject{}))
+	require.Empty(t, logger.bigKeys)
+
+	require.NoError(t, cache.Put(ctx, "a very long key", &reqCacheTestObject{}))
+	require.Equal(t, []string{"a very long key"}, logger.bigKeys)
+	require.True(t, cache.Exists(ctx, "a very long key"), "Oversized key is stored anyway")
+
+	// The warnings are rate-limited
+	require.NoError(t, cache.Put(ctx, "another long key", &reqCacheTestObject{}))
+	require.Len(t, logger.bigKeys, 1)
+
+	require.Panics(t, func() {
+		New[int, reqCacheTestObject](0, 10, WithKeySizeWarning(8, func(k string) int { return len(k) }))
+	})
+}
+
+func TestReqCache_FetchRetry(t *testing.T) {
+	t.Parallel()
+
+	var backoffs []int
+	cache := New[string, reqCacheTestObject](0, 10, WithFetchRetry(3, func(attempt int) time.Duration {
+		backoffs = append(backoffs, attempt)
+		return time.Millisecond
+	}))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	errTransient := errors.New("transient")
+	calls := 0
+	failTwice := func(context.Context) (*reqCacheTestObject, error) {
+		calls++
+		if calls <= 2 {
+			return nil, errTransient
+		}
+		return &reqCacheTestObject{value: calls}, nil
+	}
+
+	v, err := cache.GetOrFetch(ctx, "key1", failTwice)
+	require.NoError(t, err)
+	require.Equal(t, 3, v.value)
+	require.Equal(t, []int{1, 2}, backoffs)
+
+	// All attempts fail
+	calls = 0
+	_, err = cache.GetOrFetch(ctx, "key2", func(context.Context) (*reqCacheTestObject, error) {
+		calls++
+		return nil, fmt.Errorf("attempt %d: %w", calls, errTransient)
+	})
+	require.ErrorIs(t, err, errTransient)
+	require.EqualError(t, err, "attempt 3: transient")
+
+	// Cancellation stops retrying
+	cache = New[string, reqCacheTestObject](0, 10, WithFetchRetry(5, func(int) time.Duration { return time.Hour }))
+	cancelCtx, cancel := context.WithCancel(ctx)
+	calls = 0
+	_, err = cache.GetOrFetch(cancelCtx, "key", func(context.Context) (*reqCacheTestObject, error) {
+		calls++
+		cancel()
+		return nil, errTransient
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+	require.NoError(t, cache.EndSession(ctx))
+}
+
+func TestReqCache_SnapshotCopy(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](2, 10)
+	clone := func(v *reqCacheTestObject) *reqCacheTestObject {
+		c := *v
+		return &c
+	}
+
+	_, err := cache.SnapshotCopy(context.Background(), clone)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	for i := 1; i <= 2; i++ {
+		obj := cache.NewObject(ctx)
+		obj.value = i
+		require.NoError(t, cache.Put(ctx, strconv.Itoa(i), obj))
+	}
+	require.NoError(t, cache.Put(ctx, "nil", nil))
+
+	snapshot, err := cache.SnapshotCopy(ctx, clone)
+	require.NoError(t, err)
+
+	// Changes after the snapshot are not reflected
+	obj, _ := cache.Get(ctx, "1")
+	obj.value = 100
+
+	// The pooled objects are reused by the next session
+	require.NoError(t, cache.EndSession(ctx))
+	ctx = NewSession(context.Background())
+	defer cache.EndSession(ctx)
+	for i := 0; i < 2; i++ {
+		cache.NewObject(ctx).value = -1
+	}
+
+	require.Equal(t, map[string]*reqCacheTestObject{
+		"1":   {value: 1},
+		"2":   {value: 2},
+		"nil": nil,
+	}, snapshot)
+}
+
+func TestNewCacheOnly(t *testing.T) {
+	t.Parallel()
+
+	require.Panics(t, func() { NewCacheOnly[string, reqCacheTestObject](0) })
+
+	cache := NewCacheOnly[string, reqCacheTestObject](10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{value: 1}))
+	v, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	// Objects are allocated without the pool
+	require.NotNil(t, cache.NewObject(ctx))
+	used, overflow := cache.objectShard(fromContext(ctx)).objects[fromContext(ctx)].usage()
+	require.Zero(t, used)
+	require.Equal(t, 1, overflow)
+}
+
+func TestReqCache_Warm(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](100, 10)
+
+	require.ErrorIs(t, cache.Warm(context.Background()), ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Warm(ctx))
+
+	p, _ := cache.sessionObjectsIfAny(fromContext(ctx))
+	require.NotNil(t, p, "Warm should create the session's object pool")
+	require.Equal(t, 0, p.index, "Warm should not take objects from the pool")
+
+	obj := cache.NewObject(ctx)
+	require.Same(t, &p.data[0], obj)
+	require.Zero(t, *obj)
+}
+
+func TestReqCache_LockFreeSessionMap(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10, WithLockFreeSessionMap())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				ctx := NewSession(context.Background())
+
+				if cache.Exists(ctx, i) {
+					panic("new session sees data of another session")
+				}
+				if err := cache.Put(ctx, i, &reqCacheTestObject{value: j}); err != nil {
+					panic(err)
+				}
+				if v, ok := cache.Get(ctx, i); !ok || v.value != j {
+					panic("session doesn't see its own data")
+				}
+
+				cache.EndSession(ctx)
+
+				if _, ok := cache.Get(ctx, i); ok {
+					panic("ended session still sees its data")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.NoError(t, cache.CheckInvariants())
+}
+
+func TestReqCache_PutIfAbsent(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10, WithRejectNil())
+
+	_, _, err := cache.PutIfAbsent(context.Background(), 1, &reqCacheTestObject{value: 1})
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	_, _, err = cache.PutIfAbsent(ctx, 1, nil)
+	require.ErrorIs(t, err, ErrNilValue)
+
+	stored, existing, err := cache.PutIfAbsent(ctx, 1, &reqCacheTestObject{value: 1})
+	require.NoError(t, err)
+	require.True(t, stored)
+	require.Nil(t, existing)
+
+	stored, existing, err = cache.PutIfAbsent(ctx, 1, &reqCacheTestObject{value: 2})
+	require.NoError(t, err)
+	require.False(t, stored)
+	require.Equal(t, 1, existing.value)
+
+	v, _ := cache.Get(ctx, 1)
+	require.Equal(t, 1, v.value, "Existing data must not be replaced")
+
+	// A call that stores nothing doesn't make the existing data recently used
+	small := New[int, reqCacheTestObject](0, 2)
+	ctxSmall := NewSession(context.Background())
+	defer small.EndSession(ctxSmall)
+	require.NoError(t, small.Put(ctxSmall, 1, &reqCacheTestObject{value: 1}))
+	require.NoError(t, small.Put(ctxSmall, 2, &reqCacheTestObject{value: 2}))
+	stored, _, err = small.PutIfAbsent(ctxSmall, 1, &reqCacheTestObject{value: 3})
+	require.NoError(t, err)
+	require.False(t, stored)
+	require.NoError(t, small.Put(ctxSmall, 3, &reqCacheTestObject{value: 3}))
+	require.False(t, small.Exists(ctxSmall, 1), "The oldest data must be evicted")
+	require.True(t, small.Exists(ctxSmall, 2))
+
+	// Exactly one of concurrent callers wins
+	var (
+		wg   sync.WaitGroup
+		wins int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if ok, _, _ := cache.PutIfAbsent(ctx, 2, &reqCacheTestObject{value: i}); ok {
+				atomic.AddInt32(&wins, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, wins)
+}
+
+func TestReqCache_GetOrPut(t *testing.T) {
+	t.Parallel()
+
+	logger := &mockLogger{}
+	cache := New[string, reqCacheTestObject](0, 10, WithLogger("test", logger), WithRejectNil())
+
+	_, _, err := cache.GetOrPut(context.Background(), "key", &reqCacheTestObject{})
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	_, _, err = cache.GetOrPut(ctx, "key", nil)
+	require.ErrorIs(t, err, ErrNilValue)
+
+	const nParallel = 20
+
+	var (
+		wg      sync.WaitGroup
+		results [nParallel]*reqCacheTestObject
+		loaded  int32
+	)
+	for i := 0; i < nParallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			v, ok, err := cache.GetOrPut(ctx, "key", &reqCacheTestObject{value: i})
+			if err != nil {
+				panic(err)
+			}
+			if ok {
+				atomic.AddInt32(&loaded, 1)
+			}
+			results[i] = v
+		}(i)
+	}
+	wg.Wait()
+
+	// All callers converge on one stored value
+	stored, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	for _, v := range results {
+		require.Same(t, stored, v)
+	}
+	require.EqualValues(t, nParallel-1, atomic.LoadInt32(&loaded))
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	require.Equal(t, nParallel, logger.cacheHit) // nParallel-1 loaded and Get
+	require.Equal(t, 1, logger.cacheMiss)
+}
+
+func TestReqCache_ContextCancellationChecks(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(NewSession(context.Background()))
+	cancel()
+
+	fetcher := func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{}, nil
+	}
+
+	// By default, the context state is ignored except for the cache misses of GetOrFetch
+	cache := New[string, reqCacheTestObject](10, 10)
+	require.NoError(t, cache.Put(ctx, "key1", &reqCacheTestObject{}))
+	_, err := cache.GetOrFetch(ctx, "key1", fetcher)
+	require.NoError(t, err)
+	_, err = cache.GetOrFetch(ctx, "key2", fetcher)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, cache.EndSession(ctx))
+
+	cache = New[string, reqCacheTestObject](10, 10, WithContextCancellationChecks())
+
+	require.ErrorIs(t, cache.Put(ctx, "key1", &reqCacheTestObject{}), context.Canceled)
+	_, err = cache.GetOrFetch(ctx, "key1", fetcher)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = cache.GetOrFetchAlias(ctx, []string{"key1"}, fetcher)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = cache.GetOrNew(ctx, "key1", func(context.Context, *reqCacheTestObject) error { return nil })
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, cache.WithoutEviction(ctx, func() error { return nil }), context.Canceled)
+
+	require.False(t, cache.Exists(ctx, "key1"))
+	require.NoError(t, cache.EndSession(ctx))
+}
+
+func TestReqCache_GetOrFetchCanceled(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	ctx, cancel := context.WithCancel(NewSession(context.Background()))
+
+	// The context is canceled while the fetcher runs
+	obj, err := cache.GetOrFetch(ctx, "key", func(context.Context) (*reqCacheTestObject, error) {
+		cancel()
+		return &reqCacheTestObject{value: 1}, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Nil(t, obj)
+	require.False(t, cache.Exists(ctx, "key"), "The result must not be cached")
+
+	// The fetcher isn't called for a canceled context
+	_, err = cache.GetOrFetch(ctx, "key", func(context.Context) (*reqCacheTestObject, error) {
+		t.Fatal("unexpected fetch")
+		return nil, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReqCache_AutoGrow(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 2, WithAutoGrow(5))
+
+	ctx := NewSession(context.Background())
+
+	// The cache grows 2 -> 4 -> 5 instead of evicting
+	for i := 0; i < 5; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{}))
+	}
+
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 3, 4}, keys)
+
+	// The hard cap is reached, so the oldest entry is evicted
+	require.NoError(t, cache.Put(ctx, 5, &reqCacheTestObject{}))
+	keys, err = cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3, 4, 5}, keys)
+
+	// The capacity is reset for the next session
+	require.NoError(t, cache.EndSession(ctx))
+	ctx = NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	shard := cache.dataShard(fromContext(ctx))
+	shard.mu.Lock()
+	d := cache.sessionBackend(ctx, fromContext(ctx))
+	for i := 0; i < 3; i++ {
+		d.Add(i, &reqCacheTestObject{})
+	}
+	require.Equal(t, 2, d.Len(), "Storage taken from the pool should have the base capacity")
+	shard.mu.Unlock()
+}
+
+// reentrantLogger uses the cache when a session starts.
+type reentrantLogger struct {
+	mockLogger
+
+	cache *ReqCache[int, reqCacheTestObject]
+}
+
+func (m *reentrantLogger) LogSessionStart(ctx context.Context, _ string) {
+	m.cache.Exists(ctx, -1)
+}
+
+func (m *reentrantLogger) LogSessionEnd(context.Context, string, EndStats) {}
+
+func TestReqCache_AutoGrowSessionStart(t *testing.T) {
+	t.Parallel()
+
+	logger := &reentrantLogger{}
+	cache := New[int, reqCacheTestObject](0, 2, WithAutoGrow(5), WithLogger("test", logger))
+	logger.cache = cache
+
+	ctx := NewSession(context.Background())
+
+	// The start of the session is reported after the data shard lock is released
+	done := make(chan struct{})
+	go func() {
+		_ = cache.Put(ctx, 1, &reqCacheTestObject{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the logger is called under the data shard lock")
+	}
+	require.True(t, cache.Exists(ctx, 1))
+	require.NoError(t, cache.EndSession(ctx))
+}
+
+func TestAsyncReqCache(t *testing.T) {
+	t.Parallel()
+
+	const (
+		nParallel = 100
+		objCount  = 1000
+	)
+
+	var (
+		errGroup errgroup.Group
+		cache    = New[string, reqCacheTestObject](objCount, objCount)
+	)
+
+	// Ensure that we can work with multiple threads without interference between them
+	for i := 0; i < nParallel; i++ {
+		errGroup.Go(func() error {
+			ctx := NewSession(context.Background())
+			defer cache.EndSession(ctx)
+
+			objects := make([]*reqCacheTestObject, objCount)
+
+			for k := 0; k < objCount; k++ {
+				key := "key" + strconv.Itoa(k)
+				obj := cache.NewObject(ctx)
+				obj.value = k
+				if err := cache.Put(ctx, key, obj); err != nil {
+					return err
+				}
+				objects[k] = obj
+			}
+
+			for k := 0; k < objCount; k++ {
+				key := "key" + strconv.Itoa(k)
+				v, ok := cache.Get(ctx, key)
+				if !ok {
+					return fmt.Errorf("value not found, expected %d", k)
+				}
+
+				if v.value != k {
+					return fmt.Errorf("value mismatch, expected %d, got %d", k, v.value)
+				}
+
+				if v != objects[k] {
+					return fmt.Errorf("object mismatch, expected %p, got %p", objects[k], v)
+				}
+			}
+
+			reqID := fromContext(ctx)
+
+			shard := cache.dataShard(reqID)
+			shard.mu.RLock()
+			defer shard.mu.RUnlock()
+			cacheLen := shard.data[reqID].backend.Len()
+			if cacheLen != objCount {
+				return fmt.Errorf("data cache length mismatch, expected %d, got %d", objCount, cacheLen)
+			}
+
+			objShard := cache.objectShard(reqID)
+			objShard.mu.Lock()
+			defer objShard.mu.Unlock()
+			objectsLen := objShard.objects[reqID].index
+			if objectsLen != objCount {
+				return fmt.Errorf("pool length mismatch, expected %d, got %d", objCount, objectsLen)
+			}
+
+			return nil
+		})
+	}
+
+	require.NoError(t, errGroup.Wait())
+
+	// Ensure that the object pool is empty after all goroutines are done
+	for _, shard := range cache.objectShards {
+		require.Empty(t, shard.objects, "Object pool should be empty after all goroutines are done")
+	}
+	for _, shard := range cache.dataShards {
+		require.Empty(t, shard.data, "Data cache should be empty after all goroutines are done")
+	}
+}
+
+func TestReqCache_PutMany(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 3, WithRejectNil())
+
+	require.ErrorIs(t, cache.PutMany(context.Background(), map[int]*reqCacheTestObject{1: {value: 1}}),
+		ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.PutMany(ctx, nil))
+	require.NoError(t, cache.PutMany(ctx, map[int]*reqCacheTestObject{1: {value: 1}, 2: {value: 2}}))
+
+	found, missing, err := cache.GetMany(ctx, []int{1, 2})
+	require.NoError(t, err)
+	require.Empty(t, missing)
+	require.Equal(t, 1, found[1].value)
+	require.Equal(t, 2, found[2].value)
+
+	// Nothing is saved if a value is rejected
+	require.ErrorIs(t, cache.PutMany(ctx, map[int]*reqCacheTestObject{3: {value: 3}, 4: nil}), ErrNilValue)
+	require.False(t, cache.Exists(ctx, 3))
+
+	// More entries than the cache size are evicted as usual
+	require.NoError(t, cache.PutMany(ctx, map[int]*reqCacheTestObject{3: {value: 3}, 4: {value: 4}, 5: {value: 5}}))
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{3, 4, 5}, keys)
+	require.Equal(t, uint64(5), cache.LifetimeStats().Puts)
 }
@@ -0,0 +1,140 @@
+// Package reqcacheprom exports the metrics of github.com/n-r-w/reqcache caches to Prometheus.
+package reqcacheprom
+
+import (
+	"context"
+	"time"
+
+	"github.com/n-r-w/reqcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector with the metrics of a cache.
+// It receives the metrics as the metrics logger of the cache, so the logger set by reqcache.WithLogger
+// keeps receiving its notifications.
+type Collector struct {
+	hits         prometheus.Counter
+	misses       prometheus.Counter
+	poolHits     prometheus.Counter
+	overflows    prometheus.Counter
+	liveSessions prometheus.Gauge
+	fetchLatency prometheus.Histogram
+	entries      prometheus.Histogram
+}
+
+var (
+	_ prometheus.Collector    = (*Collector)(nil)
+	_ reqcache.ILogger        = (*Collector)(nil)
+	_ reqcache.IFetchLogger   = (*Collector)(nil)
+	_ reqcache.ISessionLogger = (*Collector)(nil)
+
+	_ reqcache.ISessionEntriesObserver = (*Collector)(nil)
+)
+
+// NewCollector creates a Collector for the cache with the given name and the option that attaches it to the cache
+// with reqcache.WithMetricsLogger. The name is added to all metrics as the "cache" label, so several caches
+// can be registered in one registry.
+func NewCollector(name string) (*Collector, reqcache.Option) {
+	labels := prometheus.Labels{"cache": name}
+
+	c := &Collector{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "reqcache_hits_total",
+			Help:        "Number of Get and Exists calls that found the data in the cache.",
+			ConstLabels: labels,
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "reqcache_misses_total",
+			Help:        "Number of Get and Exists calls that didn't find the data in the cache.",
+			ConstLabels: labels,
+		}),
+		poolHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "reqcache_pool_objects_total",
+			Help:        "Number of objects taken from the preallocated memory.",
+			ConstLabels: labels,
+		}),
+		overflows: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "reqcache_pool_overflows_total",
+			Help:        "Number of objects allocated because the preallocated memory was exhausted.",
+			ConstLabels: labels,
+		}),
+		liveSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "reqcache_live_sessions",
+			Help:        "Number of sessions using the cache.",
+			ConstLabels: labels,
+		}),
+		fetchLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "reqcache_fetch_duration_seconds",
+			Help:        "Duration of the fetcher calls.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}),
+		entries: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "reqcache_session_entries",
+			Help:        "Number of entries cached by a session at its end.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 16),
+		}),
+	}
+
+	return c, reqcache.WithMetricsLogger(c)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.metrics() {
+		m.Collect(ch)
+	}
+}
+
+// LogObjectPoolHitRatio implements reqcache.ILogger.
+func (c *Collector) LogObjectPoolHitRatio(_ context.Context, _ string, hit bool) {
+	if hit {
+		c.poolHits.Inc()
+	} else {
+		c.overflows.Inc()
+	}
+}
+
+// LogCacheHitRatio implements reqcache.ILogger.
+func (c *Collector) LogCacheHitRatio(_ context.Context, _ string, hit bool) {
+	if hit {
+		c.hits.Inc()
+	} else {
+		c.misses.Inc()
+	}
+}
+
+// LogFetch implements reqcache.IFetchLogger.
+func (c *Collector) LogFetch(_ context.Context, _ string, _ string, took time.Duration, _ error) {
+	c.fetchLatency.Observe(took.Seconds())
+}
+
+// LogSessionStart implements reqcache.ISessionLogger.
+func (c *Collector) LogSessionStart(context.Context, string) {
+	c.liveSessions.Inc()
+}
+
+// LogSessionEnd implements reqcache.ISessionLogger.
+func (c *Collector) LogSessionEnd(context.Context, string, reqcache.EndStats) {
+	c.liveSessions.Dec()
+}
+
+// ObserveSessionEntries implements reqcache.ISessionEntriesObserver.
+func (c *Collector) ObserveSessionEntries(_ context.Context, _ string, count int) {
+	c.entries.Observe(float64(count))
+}
+
+// metrics returns all metrics of the collector.
+func (c *Collector) metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.hits, c.misses, c.poolHits, c.overflows, c.liveSessions, c.fetchLatency, c.entries,
+	}
+}
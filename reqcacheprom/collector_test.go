@@ -0,0 +1,126 @@
+package reqcacheprom
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/n-r-w/reqcache"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+type testObject struct {
+	value int
+}
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	collector, opt := NewCollector("test")
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	cache := reqcache.New[string, testObject](1, 10, opt)
+
+	ctx := reqcache.NewSession(context.Background())
+	_, err := cache.GetOrFetch(ctx, "key", func(context.Context) (*testObject, error) {
+		return &testObject{value: 1}, nil
+	})
+	require.NoError(t, err)
+	cache.Get(ctx, "key")
+	cache.NewObject(ctx)
+	cache.NewObject(ctx)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, f := range families {
+		require.Len(t, f.GetMetric(), 1)
+		m := f.GetMetric()[0]
+		require.Equal(t, "cache", m.GetLabel()[0].GetName())
+		require.Equal(t, "test", m.GetLabel()[0].GetValue())
+
+		switch {
+		case m.GetCounter() != nil:
+			values[f.GetName()] = m.GetCounter().GetValue()
+		case m.GetGauge() != nil:
+			values[f.GetName()] = m.GetGauge().GetValue()
+		case m.GetHistogram() != nil:
+			values[f.GetName()] = float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+
+	require.Equal(t, map[string]float64{
+		"reqcache_hits_total":             1,
+		"reqcache_misses_total":           1,
+		"reqcache_pool_objects_total":     1,
+		"reqcache_pool_overflows_total":   1,
+		"reqcache_live_sessions":          1,
+		"reqcache_fetch_duration_seconds": 1,
+		"reqcache_session_entries":        0,
+	}, values)
+
+	require.NoError(t, cache.EndSession(ctx))
+
+	families, err = registry.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		switch f.GetName() {
+		case "reqcache_live_sessions":
+			require.Zero(t, f.GetMetric()[0].GetGauge().GetValue())
+		case "reqcache_session_entries":
+			require.EqualValues(t, 1, f.GetMetric()[0].GetHistogram().GetSampleCount())
+			require.InDelta(t, 1, f.GetMetric()[0].GetHistogram().GetSampleSum(), 0)
+		}
+	}
+}
+
+type countingLogger struct {
+	mu     sync.Mutex
+	starts int
+}
+
+func (l *countingLogger) LogObjectPoolHitRatio(context.Context, string, bool) {}
+
+func (l *countingLogger) LogCacheHitRatio(context.Context, string, bool) {}
+
+func (l *countingLogger) LogSessionStart(context.Context, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.starts++
+}
+
+func (l *countingLogger) LogSessionEnd(context.Context, string, reqcache.EndStats) {}
+
+func TestCollectorKeepsLogger(t *testing.T) {
+	t.Parallel()
+
+	collector, opt := NewCollector("test")
+	logger := &countingLogger{}
+
+	// The collector doesn't replace the logger and receives the hits when only the metrics are enabled
+	cache := reqcache.New[string, testObject](1, 10, reqcache.WithLogger("test", logger), opt,
+		reqcache.WithObservabilityMode(reqcache.ObservabilityMetricsOnly))
+
+	ctx := reqcache.NewSession(context.Background())
+	require.NoError(t, cache.Put(ctx, "key", &testObject{value: 1}))
+	cache.Get(ctx, "key")
+	require.NoError(t, cache.EndSession(ctx))
+
+	require.Equal(t, 1, logger.starts)
+	require.InDelta(t, 1, counterValue(t, collector.hits), 0)
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	require.NoError(t, c.Write(&m))
+
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,84 @@
+package reqcache
+
+import (
+	"context"
+	"sync"
+)
+
+// ScratchBuffer returns an empty byte slice with a capacity of at least minCap and a function releasing it.
+// Released buffers are reused by the following calls within the session and are passed to the next sessions
+// after EndSession. It reduces allocations of temporary buffers, for example, for encoding.
+// The buffer must not be used after the release function is called. Repeated calls of the function are ignored.
+func (m *ReqCache[K, T]) ScratchBuffer(ctx context.Context, minCap int) ([]byte, func(), error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state := m.trackSession(ctx, requestKey)
+	buf := state.takeScratch(minCap)
+
+	if buf == nil {
+		if p, ok := m.scratchPool.Get().(*[]byte); ok && cap(*p) >= minCap {
+			buf = (*p)[:0]
+		} else {
+			buf = make([]byte, 0, minCap)
+		}
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { state.putScratch(buf) })
+	}
+
+	return buf, release, nil
+}
+
+// releaseScratch passes the session's released buffers of ScratchBuffer to the next sessions.
+func (m *ReqCache[K, T]) releaseScratch(state *sessionState[K, T]) {
+	var buffers [][]byte
+
+	state.mu.Lock()
+	if state.extra != nil {
+		buffers = state.extra.scratch
+		state.extra.scratch = nil
+	}
+	state.mu.Unlock()
+
+	for i := range buffers {
+		m.scratchPool.Put(&buffers[i])
+	}
+}
+
+// takeScratch returns a released buffer with a capacity of at least minCap or nil if there is none.
+func (s *sessionState[K, T]) takeScratch(minCap int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.extra == nil {
+		return nil
+	}
+
+	x := s.extra
+	for i, buf := range x.scratch {
+		if cap(buf) >= minCap {
+			last := len(x.scratch) - 1
+			x.scratch[i] = x.scratch[last]
+			x.scratch[last] = nil
+			x.scratch = x.scratch[:last]
+
+			return buf[:0]
+		}
+	}
+
+	return nil
+}
+
+// putScratch adds a released buffer.
+func (s *sessionState[K, T]) putScratch(buf []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	x := s.extras()
+	x.scratch = append(x.scratch, buf)
+}
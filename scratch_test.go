@@ -0,0 +1,54 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_ScratchBuffer(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 1)
+
+	_, _, err := cache.ScratchBuffer(context.Background(), 10)
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+
+	buf1, release1, err := cache.ScratchBuffer(ctx, 100)
+	require.NoError(t, err)
+	require.Empty(t, buf1)
+	require.GreaterOrEqual(t, cap(buf1), 100)
+	buf1 = append(buf1, "data"...)
+
+	// The buffer in use is not handed out again
+	buf2, release2, err := cache.ScratchBuffer(ctx, 10)
+	require.NoError(t, err)
+	require.NotSame(t, &buf1[:1][0], &buf2[:1][0])
+
+	// The released buffer is reused
+	release1()
+	release1()
+	buf3, release3, err := cache.ScratchBuffer(ctx, 50)
+	require.NoError(t, err)
+	require.Empty(t, buf3)
+	require.Same(t, &buf1[:1][0], &buf3[:1][0])
+
+	// The released buffer is too small
+	release2()
+	buf4, release4, err := cache.ScratchBuffer(ctx, 1000)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, cap(buf4), 1000)
+
+	release3()
+	release4()
+
+	state := cache.trackSession(ctx, fromContext(ctx))
+	require.Len(t, state.extras().scratch, 3)
+
+	// The buffers are released by the end of the session
+	require.NoError(t, cache.EndSession(ctx))
+	require.Empty(t, state.extras().scratch)
+}
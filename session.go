@@ -0,0 +1,560 @@
+package reqcache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//nolint:gochecknoglobals // process-wide session counters
+var (
+	liveSessionIDs  sync.Map // session id -> liveness flag of sessionValue, filled while liveRegistryFrom is set
+	liveSessions    int64
+	maxLiveSessions int64
+	// id of the first session registered in liveSessionIDs, 0 until a cache needs the registry, accessed atomically
+	liveRegistryFrom uint64
+)
+
+// MaxConcurrentSessions returns the maximum number of concurrent sessions observed since the process start
+// or the last ResetMaxConcurrentSessions call.
+// A session is live from NewSession until the first EndSession call for it on any cache, see also ForceEndSession.
+func MaxConcurrentSessions() uint64 {
+	return uint64(atomic.LoadInt64(&maxLiveSessions))
+}
+
+// ResetMaxConcurrentSessions resets the value returned by MaxConcurrentSessions to the current number of live sessions.
+// It is intended for tests.
+func ResetMaxConcurrentSessions() {
+	atomic.StoreInt64(&maxLiveSessions, atomic.LoadInt64(&liveSessions))
+}
+
+// enableLiveRegistry makes NewSession register the sessions in liveSessionIDs, so ForceEndSession can end them
+// without their contexts and CheckInvariants can find the ended ones. It is called by New for the caches
+// with WithLeakThreshold or a session logger, other caches don't pay for the registry.
+func enableLiveRegistry() {
+	atomic.CompareAndSwapUint64(&liveRegistryFrom, 0, atomic.LoadUint64(&requestID)+1)
+}
+
+// liveRegistered reports whether the session must be in liveSessionIDs while it is live.
+func liveRegistered(id uint64) bool {
+	from := atomic.LoadUint64(&liveRegistryFrom)
+
+	return from != 0 && id >= from
+}
+
+// startLiveSession counts a new session and updates the watermark.
+func startLiveSession(id uint64, liveFlag *uint32) {
+	if liveRegistered(id) {
+		liveSessionIDs.Store(id, liveFlag)
+	}
+	live := atomic.AddInt64(&liveSessions, 1)
+
+	for {
+		maxLive := atomic.LoadInt64(&maxLiveSessions)
+		if live <= maxLive || atomic.CompareAndSwapInt64(&maxLiveSessions, maxLive, live) {
+			return
+		}
+	}
+}
+
+// endLiveSession stops counting the session. Repeated calls for the same session are ignored.
+// liveFlag is taken from the session's context, nil means the context is unknown, e.g. for ForceEndSession,
+// and then the session is found in liveSessionIDs.
+func endLiveSession(id uint64, liveFlag *uint32) {
+	if liveRegistered(id) {
+		if v, ok := liveSessionIDs.LoadAndDelete(id); ok && liveFlag == nil {
+			liveFlag, _ = v.(*uint32)
+		}
+	}
+
+	if liveFlag != nil && atomic.CompareAndSwapUint32(liveFlag, 1, 0) {
+		atomic.AddInt64(&liveSessions, -1)
+	}
+}
+
+// sessionState contains auxiliary data of a session that uses the cache.
+type sessionState[K comparable, T any] struct {
+	lookups lookupCounters // lookups of the session for Stats, placed first for 64-bit alignment
+
+	live *uint32    // liveness flag of the session's context, nil if the session was registered without it
+	lock sync.Mutex // returned by SessionLock
+
+	// guarded by the lock of the session's data shard
+	noEvictionDepth int // number of active WithoutEviction calls
+	growCapacity    int // capacity of the session's storage set by WithAutoGrow, 0 if it wasn't changed
+
+	mu            sync.Mutex           // guards the fields below
+	flights       map[K]*flightCall[T] // fetches in progress, by shared key
+	pendingWrites int                  // number of fetches that haven't stored their results yet
+	extra         *sessionExtras[K, T] // allocated by extras
+}
+
+// sessionExtras contains the data of the rarely used features of a session, guarded by the mu of its sessionState.
+// It is allocated on the first use, so the sessions that don't use them stay small.
+type sessionExtras[K comparable, T any] struct {
+	fetchFailures map[K]fetchFailure
+	flushWaiters  []chan struct{}           // closed when pendingWrites drops to zero
+	scratch       [][]byte                  // released buffers of ScratchBuffer
+	requestedKeys map[K]struct{}            // keys looked up or fetched, set by WithEfficiencyTracking
+	fetchedKeys   map[K]struct{}            // keys fetched, set by WithEfficiencyTracking
+	keyLocks      *keyLocks                 // locks of ValueCache.Update, selected by the key hash
+	fetchTimes    map[K]time.Time           // fetch times of RefreshIfOlderThan
+	operations    []Operation[K, T]         // set by WithOperationRecording
+	tags          map[string]map[K]struct{} // keys stored by PutTagged, by tag
+	accessTimes   map[K]time.Time           // last access times of the entries, set by WithIdleTimeout
+}
+
+// flightCall is a fetcher call shared by concurrent fetches of the same key.
+type flightCall[T any] struct {
+	done    chan struct{} // closed when the call is finished
+	obj     *T
+	control CacheControl // returned by the fetcher of GetOrFetchControlled
+	err     error
+}
+
+// fetchFailure is a fetcher error remembered by WithFetchFailureCaching.
+type fetchFailure struct {
+	err     error
+	expires time.Time
+}
+
+// newSessionState creates a new sessionState.
+func newSessionState[K comparable, T any]() *sessionState[K, T] {
+	return &sessionState[K, T]{
+		lookups:         lookupCounters{getHits: 0, getMisses: 0, hits: 0, misses: 0},
+		live:            nil,
+		lock:            sync.Mutex{},
+		noEvictionDepth: 0,
+		growCapacity:    0,
+		mu:              sync.Mutex{},
+		flights:         nil,
+		pendingWrites:   0,
+		extra:           nil,
+	}
+}
+
+// extras returns the data of the rarely used features of the session, allocating it on the first call.
+// Must be called under s.mu.
+func (s *sessionState[K, T]) extras() *sessionExtras[K, T] {
+	if s.extra == nil {
+		s.extra = &sessionExtras[K, T]{
+			fetchFailures: nil,
+			flushWaiters:  nil,
+			scratch:       nil,
+			requestedKeys: nil,
+			fetchedKeys:   nil,
+			keyLocks:      nil,
+			fetchTimes:    nil,
+			operations:    nil,
+			tags:          nil,
+			accessTimes:   nil,
+		}
+	}
+
+	return s.extra
+}
+
+// beginWrite registers a fetch whose result will be stored in the cache.
+func (s *sessionState[K, T]) beginWrite() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pendingWrites++
+}
+
+// endWrite marks the fetch registered by beginWrite as finished and wakes up Flush if there are no more of them.
+func (s *sessionState[K, T]) endWrite() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pendingWrites--
+	if s.pendingWrites > 0 || s.extra == nil {
+		return
+	}
+
+	for _, ch := range s.extra.flushWaiters {
+		close(ch)
+	}
+	s.extra.flushWaiters = nil
+}
+
+// waitWrites waits until there are no pending writes or the context is done.
+func (s *sessionState[K, T]) waitWrites(ctx context.Context) error {
+	s.mu.Lock()
+	if s.pendingWrites == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+
+	ch := make(chan struct{})
+	x := s.extras()
+	x.flushWaiters = append(x.flushWaiters, ch)
+	s.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchTime returns the time when the key was fetched by RefreshIfOlderThan.
+func (s *sessionState[K, T]) fetchTime(key K) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.extra == nil {
+		return time.Time{}, false
+	}
+
+	t, ok := s.extra.fetchTimes[key]
+
+	return t, ok
+}
+
+// setFetchTime remembers the time when the key was fetched by RefreshIfOlderThan.
+func (s *sessionState[K, T]) setFetchTime(key K, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	x := s.extras()
+	if x.fetchTimes == nil {
+		x.fetchTimes = make(map[K]time.Time)
+	}
+	x.fetchTimes[key] = t
+}
+
+// keyLock returns the lock of the key, creating the locks of the session on the first call.
+// Keys with the same hash share the lock.
+func (s *sessionState[K, T]) keyLock(key K) *sync.Mutex {
+	s.mu.Lock()
+	x := s.extras()
+	if x.keyLocks == nil {
+		x.keyLocks = &keyLocks{}
+	}
+	locks := x.keyLocks
+	s.mu.Unlock()
+
+	return &locks[keyLockStripe(key)]
+}
+
+// shareFetch calls fn unless a call for the key is already in progress, in which case it waits for that call
+// and returns its result. The wait is interrupted by the end of the context, returning the context error.
+func (s *sessionState[K, T]) shareFetch(ctx context.Context, key K,
+	fn func() (*T, CacheControl, error),
+) (*T, CacheControl, error) {
+	s.mu.Lock()
+	if c, ok := s.flights[key]; ok {
+		s.mu.Unlock()
+
+		select {
+		case <-c.done:
+			return c.obj, c.control, c.err
+		case <-ctx.Done():
+			return nil, CacheControl{TTL: 0, NoStore: false}, ctx.Err()
+		}
+	}
+
+	c := &flightCall[T]{done: make(chan struct{}), obj: nil, control: CacheControl{TTL: 0, NoStore: false}, err: nil}
+	if s.flights == nil {
+		s.flights = make(map[K]*flightCall[T])
+	}
+	s.flights[key] = c
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.flights, key)
+		s.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.obj, c.control, c.err = fn()
+
+	return c.obj, c.control, c.err
+}
+
+// capacity returns the current capacity of the session's storage.
+// Must be called under the lock of the session's data shard.
+func (s *sessionState[K, T]) capacity(base int) int {
+	if s.growCapacity > 0 {
+		return s.growCapacity
+	}
+
+	return base
+}
+
+// fetchFailure returns the remembered fetcher error for the key if it hasn't expired yet.
+func (s *sessionState[K, T]) fetchFailure(key K, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.extra == nil {
+		return nil
+	}
+
+	f, ok := s.extra.fetchFailures[key]
+	if !ok {
+		return nil
+	}
+
+	if !now.Before(f.expires) {
+		delete(s.extra.fetchFailures, key)
+		return nil
+	}
+
+	return f.err
+}
+
+// setFetchFailure remembers the fetcher error for the key until expires or forgets it if err is nil.
+func (s *sessionState[K, T]) setFetchFailure(key K, err error, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		if s.extra != nil {
+			delete(s.extra.fetchFailures, key)
+		}
+		return
+	}
+
+	x := s.extras()
+	if x.fetchFailures == nil {
+		x.fetchFailures = make(map[K]fetchFailure)
+	}
+	x.fetchFailures[key] = fetchFailure{err: err, expires: expires}
+}
+
+// Flush waits until the fetches of the session started by GetOrFetch and similar methods in other goroutines
+// store their results, so the following reads see them. If new fetches start while waiting, Flush waits for them too.
+// Returns the context error if the context is done before that.
+// Must not be called from a fetcher, because it would wait for itself.
+func (m *ReqCache[K, T]) Flush(ctx context.Context) error {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, ok := m.lookupSession(requestKey)
+
+	if !ok {
+		return nil
+	}
+
+	return state.waitWrites(ctx)
+}
+
+// beginWrite registers a fetch of the session whose result will be stored in the cache, so Flush waits for it.
+// The returned function must be called when the result is stored or the fetch fails.
+func (m *ReqCache[K, T]) beginWrite(ctx context.Context) func() {
+	state := m.trackSession(ctx, fromContext(ctx))
+	state.beginWrite()
+
+	return state.endWrite
+}
+
+// SessionLock returns a mutex bound to the session.
+// It can be used to serialize work of goroutines sharing the session, for example, access to a non-cache resource.
+// The mutex is created on the first call and is forgotten by EndSession.
+func (m *ReqCache[K, T]) SessionLock(ctx context.Context) (sync.Locker, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m.trackSession(ctx, requestKey).lock, nil
+}
+
+// keyLock returns a mutex bound to the session's key. The session has a fixed number of mutexes
+// shared by the keys, so different keys may get the same mutex.
+func (m *ReqCache[K, T]) keyLock(ctx context.Context, dataKey K) (sync.Locker, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.trackSession(ctx, requestKey).keyLock(m.effectiveKey(ctx, dataKey)), nil
+}
+
+// trackSession returns the state of the session.
+// If the session has just started using the cache, registers it and checks the leak threshold.
+// If the session isn't registered and has already ended, returns a detached state instead of registering it again,
+// so the late calls of the session, e.g. of the fetchers left running by WithBatchDeadline, don't leave a state behind.
+func (m *ReqCache[K, T]) trackSession(ctx context.Context, requestKey uint64) *sessionState[K, T] {
+	s, live := m.registerSession(ctx, requestKey, true)
+	if live > 0 {
+		m.sessionStarted(ctx, live)
+	}
+
+	return s
+}
+
+// registerSession works like trackSession, but doesn't report the start of the session, so it may be called
+// under the data shard lock. If the session has just been registered, returns the number of live sessions
+// to be passed to sessionStarted after releasing the lock, otherwise 0.
+// The ended sessions are registered again only if onlyLive is false.
+func (m *ReqCache[K, T]) registerSession(ctx context.Context, requestKey uint64,
+	onlyLive bool,
+) (*sessionState[K, T], int) {
+	shard := m.sessionShard(requestKey)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if s, ok := shard.sessions[requestKey]; ok {
+		return s, 0
+	}
+
+	s := newSessionState[K, T]()
+	s.live = sessionLiveFlag(ctx)
+	// endSession marks the session as ended before removing its state under the same lock
+	if onlyLive && s.live != nil && atomic.LoadUint32(s.live) == 0 {
+		return s, 0
+	}
+	shard.sessions[requestKey] = s
+	live := atomic.AddInt64(&m.liveSessions, 1)
+	if m.expvars != nil {
+		m.expvars.liveSessions.Add(1)
+	}
+	atomic.AddUint64(&m.lifetime.sessionsStarted, 1)
+
+	return s, int(live)
+}
+
+// sessionStarted checks the leak threshold and reports the start of a session registered by registerSession.
+// Must not be called under the cache locks, because it calls the logger.
+func (m *ReqCache[K, T]) sessionStarted(ctx context.Context, live int) {
+	m.checkLeaks(ctx, live)
+
+	name, loggers := m.logger.getAll(ctx)
+	for _, logger := range loggers {
+		if sessionLogger, isSessionLogger := logger.(ISessionLogger); isSessionLogger {
+			sessionLogger.LogSessionStart(ctx, name)
+		}
+	}
+}
+
+// checkLeaks warns if the number of live sessions exceeds the leak threshold.
+func (m *ReqCache[K, T]) checkLeaks(ctx context.Context, live int) {
+	if m.op.leakThreshold <= 0 || live <= m.op.leakThreshold {
+		return
+	}
+
+	name, logger := m.logger.get(ctx)
+	leakLogger, ok := logger.(ISessionLeakLogger)
+	if !ok || !m.leakWarnings.allow(time.Now()) {
+		return
+	}
+
+	leakLogger.LogSessionLeakWarning(ctx, name, live)
+}
+
+// SessionSnapshot describes a live session using the cache at the moment of the SessionsSnapshot call.
+type SessionSnapshot struct {
+	// ID is the session identifier, as returned by SessionID.
+	ID uint64
+	// Entries is the number of entries cached by the session.
+	Entries int
+	// RequestedKeys and FetchedKeys are the values returned by SessionEfficiency.
+	// They are zero unless WithEfficiencyTracking is set.
+	RequestedKeys int
+	FetchedKeys   int
+	// CacheHits and CacheMisses are the lookup counters of the session, as returned by Stats.
+	CacheHits   uint64
+	CacheMisses uint64
+}
+
+// HitRatio returns the ratio of cache hits to all lookups of the session. Returns 0 if there were no lookups.
+func (s SessionSnapshot) HitRatio() float64 {
+	if s.CacheHits+s.CacheMisses == 0 {
+		return 0
+	}
+
+	return float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+}
+
+// SessionsSnapshot returns the live sessions using the cache ordered by ID. Live sessions are the ones that used
+// the cache and were not finished with EndSession yet. It is intended for debugging and admin endpoints:
+// the values are copied under the locks, so the result doesn't change with the sessions.
+func (m *ReqCache[K, T]) SessionsSnapshot() []SessionSnapshot {
+	live := int(atomic.LoadInt64(&m.liveSessions))
+	res := make([]SessionSnapshot, 0, live)
+	states := make(map[uint64]*sessionState[K, T], live)
+	for _, shard := range m.sessionShards {
+		shard.mu.Lock()
+		for id, s := range shard.sessions {
+			res = append(res, SessionSnapshot{
+				ID:            id,
+				Entries:       0,
+				RequestedKeys: 0,
+				FetchedKeys:   0,
+				CacheHits:     0,
+				CacheMisses:   0,
+			})
+			states[id] = s
+		}
+		shard.mu.Unlock()
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	for i := range res {
+		shard := m.dataShard(res[i].ID)
+		shard.mu.RLock()
+		if e, ok := shard.data[res[i].ID]; ok {
+			res[i].Entries = e.backend.Len()
+		}
+		shard.mu.RUnlock()
+	}
+
+	for i := range res {
+		s := states[res[i].ID]
+		res[i].CacheHits, res[i].CacheMisses, _ = s.lookups.load()
+		s.mu.Lock()
+		if s.extra != nil {
+			res[i].RequestedKeys, res[i].FetchedKeys = len(s.extra.requestedKeys), len(s.extra.fetchedKeys)
+		}
+		s.mu.Unlock()
+	}
+
+	return res
+}
+
+// Session is a session of a single cache started by Begin. Close ends it, so the session can be finished
+// with a deferred call instead of passing the context to EndSession.
+type Session struct {
+	ctx  context.Context
+	end  func(ctx context.Context) error
+	once sync.Once
+}
+
+// Begin starts a new session like NewSession and returns it with its context.
+// Returns ErrSessionAlreadyStarted if the context already has a session.
+func (m *ReqCache[K, T]) Begin(ctx context.Context) (*Session, context.Context, error) {
+	if InContext(ctx) {
+		return nil, nil, ErrSessionAlreadyStarted
+	}
+
+	sessionCtx := newSession(ctx, "", "", -1)
+
+	return &Session{
+		ctx:  sessionCtx,
+		end:  m.EndSession,
+		once: sync.Once{},
+	}, sessionCtx, nil
+}
+
+// Context returns the context of the session.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Close ends the session like EndSession. Repeated calls do nothing and return nil.
+func (s *Session) Close() error {
+	var err error
+	s.once.Do(func() { err = s.end(s.ctx) })
+
+	return err
+}
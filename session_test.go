@@ -0,0 +1,366 @@
+package reqcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestReqCache_SessionLock(t *testing.T) {
+	t.Parallel()
+
+	const (
+		nParallel  = 2
+		increments = 1000
+	)
+
+	cache := New[string, reqCacheTestObject](1, 1)
+
+	_, err := cache.SessionLock(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+
+	lock, err := cache.SessionLock(ctx)
+	require.NoError(t, err)
+
+	// Goroutines sharing the session serialize on the same lock
+	var (
+		errGroup errgroup.Group
+		counter  int
+	)
+
+	for i := 0; i < nParallel; i++ {
+		errGroup.Go(func() error {
+			l, lockErr := cache.SessionLock(ctx)
+			if lockErr != nil {
+				return lockErr
+			}
+
+			for k := 0; k < increments; k++ {
+				l.Lock()
+				counter++
+				l.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	require.NoError(t, errGroup.Wait())
+	require.Equal(t, nParallel*increments, counter)
+
+	// The lock is forgotten at the session end
+	cache.EndSession(ctx)
+	require.Empty(t, cache.SessionsSnapshot())
+
+	lock.Lock()
+	newLock, err := cache.SessionLock(NewSession(context.Background()))
+	require.NoError(t, err)
+	require.NotSame(t, lock, newLock)
+	newLock.Lock()
+	newLock.Unlock()
+	lock.Unlock()
+}
+
+// Not parallel: the counters are process-wide.
+func TestMaxConcurrentSessions(t *testing.T) {
+	cache := New[string, reqCacheTestObject](1, 1)
+
+	ResetMaxConcurrentSessions()
+	base := MaxConcurrentSessions()
+
+	// 3 overlapping sessions
+	ctx1 := NewSession(context.Background())
+	ctx2 := NewSession(context.Background())
+	ctx3 := NewSession(context.Background())
+	require.Equal(t, base+3, MaxConcurrentSessions())
+
+	cache.EndSession(ctx1)
+	cache.EndSession(ctx2)
+
+	// Repeated EndSession on another cache doesn't affect the counters
+	New[int, int](1, 1).EndSession(ctx2)
+
+	// Only 2 sessions are live now, the watermark stays
+	ctx4 := NewSession(context.Background())
+	require.Equal(t, base+3, MaxConcurrentSessions())
+
+	cache.EndSession(ctx3)
+	cache.EndSession(ctx4)
+
+	ResetMaxConcurrentSessions()
+	require.Equal(t, base, MaxConcurrentSessions())
+}
+
+// Not parallel: changes the process-wide registry of live sessions.
+func TestLiveSessionRegistry(t *testing.T) {
+	saved := atomic.LoadUint64(&liveRegistryFrom)
+	atomic.StoreUint64(&liveRegistryFrom, 0)
+	defer atomic.StoreUint64(&liveRegistryFrom, saved)
+
+	registered := func(ctx context.Context) bool {
+		_, ok := liveSessionIDs.Load(fromContext(ctx))
+		return ok
+	}
+
+	// Without the caches needing it, sessions are not registered, but still counted
+	plain := New[string, reqCacheTestObject](1, 1)
+	ctx1 := NewSession(context.Background())
+	require.False(t, registered(ctx1))
+	live := atomic.LoadInt64(&liveSessions)
+	require.NoError(t, plain.EndSession(ctx1))
+	require.NoError(t, plain.EndSession(ctx1))
+	require.Equal(t, live-1, atomic.LoadInt64(&liveSessions))
+
+	// A cache with a leak threshold enables the registry for the sessions started afterwards
+	cache := New[string, reqCacheTestObject](1, 1, WithLeakThreshold(1000))
+	ctx2 := NewSession(context.Background())
+	require.True(t, registered(ctx2))
+
+	id2, err := SessionID(ctx2)
+	require.NoError(t, err)
+	require.NoError(t, cache.ForceEndSession(id2))
+	require.False(t, registered(ctx2))
+	require.Equal(t, live-1, atomic.LoadInt64(&liveSessions))
+
+	// The ended session isn't counted again
+	require.NoError(t, cache.EndSession(ctx2))
+	require.Equal(t, live-1, atomic.LoadInt64(&liveSessions))
+}
+
+func TestReqCache_OwnerCheck(t *testing.T) {
+	t.Parallel()
+
+	_, err := ShareSession(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	shared, err := ShareSession(ctx)
+	require.NoError(t, err)
+
+	// Without the option any context can end the session
+	cache := New[string, reqCacheTestObject](1, 1)
+	require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{}))
+	require.NoError(t, cache.EndSession(shared))
+	require.False(t, cache.Exists(ctx, "key"))
+
+	cache = New[string, reqCacheTestObject](1, 1, WithOwnerCheck())
+	require.NoError(t, cache.Put(shared, "key", &reqCacheTestObject{}))
+
+	// The shared context works with the session, but can't end it
+	require.True(t, cache.Exists(shared, "key"))
+	require.ErrorIs(t, cache.EndSession(shared), ErrWrongSessionOwner)
+	_, err = cache.EndSessionStats(shared)
+	require.ErrorIs(t, err, ErrWrongSessionOwner)
+	require.True(t, cache.Exists(ctx, "key"))
+
+	require.NoError(t, cache.EndSession(ctx))
+	require.False(t, cache.Exists(ctx, "key"))
+}
+
+// namedLogger counts cache hits and misses by the name passed to the logger.
+type namedLogger struct {
+	mu     sync.Mutex
+	hits   map[string]int
+	misses map[string]int
+}
+
+func (l *namedLogger) LogObjectPoolHitRatio(context.Context, string, bool) {}
+
+func (l *namedLogger) LogCacheHitRatio(_ context.Context, name string, hit bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if hit {
+		l.hits[name]++
+	} else {
+		l.misses[name]++
+	}
+}
+
+func TestNewSessionNamed(t *testing.T) {
+	t.Parallel()
+
+	logger := &namedLogger{hits: map[string]int{}, misses: map[string]int{}}
+	cache := New[string, reqCacheTestObject](0, 10, WithLogger("cache", logger))
+
+	ctxList, err := NewSessionNamed(context.Background(), "list")
+	require.NoError(t, err)
+	defer cache.EndSession(ctxList)
+
+	ctxGet, err := NewSessionNamed(context.Background(), "get")
+	require.NoError(t, err)
+	defer cache.EndSession(ctxGet)
+
+	ctxDefault, err := NewSessionNamed(context.Background(), "")
+	require.NoError(t, err)
+	defer cache.EndSession(ctxDefault)
+
+	require.NoError(t, cache.Put(ctxList, "key", &reqCacheTestObject{}))
+	cache.Get(ctxList, "key")
+	cache.Get(ctxList, "key")
+	cache.Get(ctxGet, "key")
+	cache.Get(ctxDefault, "key")
+
+	// Shared contexts keep the name
+	ctxShared, err := ShareSession(ctxGet)
+	require.NoError(t, err)
+	cache.Exists(ctxShared, "key")
+
+	require.Equal(t, map[string]int{"list": 2}, logger.hits)
+	require.Equal(t, map[string]int{"get": 2, "cache": 1}, logger.misses)
+
+	_, err = NewSessionNamed(ctxList, "other")
+	require.ErrorIs(t, err, ErrSessionAlreadyStarted)
+}
+
+func TestNewSessionSized(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](2, 10)
+
+	_, err := NewSessionSized(context.Background(), -1)
+	require.ErrorIs(t, err, ErrNegativeObjectSize)
+
+	ctx, err := NewSessionSized(context.Background(), 5)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		cache.NewObject(ctx)
+	}
+	stats, err := cache.EndSessionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 5, stats.PooledObjectsUsed)
+	require.Zero(t, stats.OverflowObjects)
+
+	// Sessions without a size use the objSize of the cache
+	ctx = NewSession(context.Background())
+	for i := 0; i < 3; i++ {
+		cache.NewObject(ctx)
+	}
+	stats, err = cache.EndSessionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.PooledObjectsUsed)
+	require.Equal(t, 1, stats.OverflowObjects)
+
+	_, err = NewSessionSized(ctx, 1)
+	require.ErrorIs(t, err, ErrSessionAlreadyStarted)
+}
+
+func TestReqCache_Flush(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	require.ErrorIs(t, cache.Flush(context.Background()), ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// Nothing is pending
+	require.NoError(t, cache.Flush(ctx))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_, _ = cache.GetOrFetch(ctx, "key", func(context.Context) (*reqCacheTestObject, error) {
+			close(started)
+			<-release
+			return &reqCacheTestObject{value: 1}, nil
+		})
+	}()
+	<-started
+
+	// Flush respects the context while the fetch is in flight
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, cache.Flush(timeoutCtx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+
+	require.NoError(t, cache.Flush(ctx))
+
+	v, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	<-done
+}
+
+func TestReqCache_SessionsSnapshot(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10, WithEfficiencyTracking())
+	require.Empty(t, cache.SessionsSnapshot())
+
+	ctx1 := NewSession(context.Background())
+	ctx2 := NewSession(context.Background())
+	ctx3 := NewSession(context.Background()) // doesn't use the cache
+	defer cache.EndSession(ctx3)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, cache.Put(ctx1, i, &reqCacheTestObject{value: i}))
+	}
+	_, err := cache.GetOrFetch(ctx1, 5, func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: 5}, nil
+	})
+	require.NoError(t, err)
+	_, _ = cache.Get(ctx1, 1)
+
+	require.False(t, cache.Exists(ctx2, 1))
+
+	id1, err := SessionID(ctx1)
+	require.NoError(t, err)
+	id2, err := SessionID(ctx2)
+	require.NoError(t, err)
+
+	require.Equal(t, []SessionSnapshot{
+		{ID: id1, Entries: 4, RequestedKeys: 2, FetchedKeys: 1, CacheHits: 1, CacheMisses: 1},
+		{ID: id2, Entries: 0, RequestedKeys: 1, FetchedKeys: 0, CacheHits: 0, CacheMisses: 1},
+	}, cache.SessionsSnapshot())
+	require.InDelta(t, 0.5, cache.SessionsSnapshot()[0].HitRatio(), 1e-9)
+	require.Zero(t, cache.SessionsSnapshot()[1].HitRatio())
+
+	require.NoError(t, cache.EndSession(ctx1))
+	snapshot := cache.SessionsSnapshot()
+	require.Len(t, snapshot, 1)
+	require.Equal(t, id2, snapshot[0].ID)
+
+	require.NoError(t, cache.EndSession(ctx2))
+	require.Empty(t, cache.SessionsSnapshot())
+}
+
+func TestReqCache_Begin(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10)
+
+	sess, ctx, err := cache.Begin(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, ctx, sess.Context())
+	require.True(t, InContext(ctx))
+
+	_, _, err = cache.Begin(ctx)
+	require.ErrorIs(t, err, ErrSessionAlreadyStarted)
+
+	require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+	require.Len(t, cache.SessionsSnapshot(), 1)
+
+	require.NoError(t, sess.Close())
+	require.Empty(t, cache.SessionsSnapshot())
+	require.NoError(t, cache.CheckInvariants())
+
+	// Repeated calls do nothing
+	require.NoError(t, sess.Close())
+}
@@ -0,0 +1,123 @@
+package reqcache
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultShards is the number of data and object shards used unless overridden in tests.
+const defaultShards = 32
+
+// dataShard is a part of the map of the session storages with its own lock, selected by the session id.
+// Sessions of different shards don't contend for the lock, so parallel requests don't serialize on one mutex.
+// The lock also guards the storages of the shard's sessions and the fields of their states marked as such.
+type dataShard[K comparable, T any] struct {
+	mu   sync.RWMutex
+	data map[uint64]*sessionData[K, T]
+}
+
+// sessionData is the entry of a session in its data shard. Entries are pooled together with their storages.
+type sessionData[K comparable, T any] struct {
+	state       *sessionState[K, T] // state of the session, registered when the entry is created
+	backend     Backend[K, T]
+	expirations map[K]time.Time // expiration times of the entries set by WithTTL or GetOrFetchControlled
+}
+
+// objectShard is a part of the map of the session object pools with its own lock, selected by the session id
+// in the same way as dataShard.
+type objectShard[T any] struct {
+	mu      sync.Mutex
+	objects map[uint64]*objectPool[T]
+}
+
+// sessionShard is a part of the map of the session states with its own lock, selected by the session id
+// in the same way as dataShard. The states are looked up on the miss and store paths, so they are sharded
+// to not serialize parallel requests on one mutex either.
+type sessionShard[K comparable, T any] struct {
+	mu       sync.Mutex
+	sessions map[uint64]*sessionState[K, T]
+}
+
+// newDataShards creates n data shards.
+func newDataShards[K comparable, T any](n int) []*dataShard[K, T] {
+	shards := make([]*dataShard[K, T], n)
+	for i := range shards {
+		shards[i] = &dataShard[K, T]{
+			mu:   sync.RWMutex{},
+			data: make(map[uint64]*sessionData[K, T]),
+		}
+	}
+
+	return shards
+}
+
+// newObjectShards creates n object shards.
+func newObjectShards[T any](n int) []*objectShard[T] {
+	shards := make([]*objectShard[T], n)
+	for i := range shards {
+		shards[i] = &objectShard[T]{
+			mu:      sync.Mutex{},
+			objects: make(map[uint64]*objectPool[T]),
+		}
+	}
+
+	return shards
+}
+
+// newSessionShards creates n session shards.
+func newSessionShards[K comparable, T any](n int) []*sessionShard[K, T] {
+	shards := make([]*sessionShard[K, T], n)
+	for i := range shards {
+		shards[i] = &sessionShard[K, T]{
+			mu:       sync.Mutex{},
+			sessions: make(map[uint64]*sessionState[K, T]),
+		}
+	}
+
+	return shards
+}
+
+// dataShard returns the data shard of the session.
+func (m *ReqCache[K, T]) dataShard(requestKey uint64) *dataShard[K, T] {
+	return m.dataShards[requestKey%uint64(len(m.dataShards))]
+}
+
+// backend returns the storage of the session. Must be called under the lock of the shard.
+func (s *dataShard[K, T]) backend(requestKey uint64) (Backend[K, T], bool) {
+	e, ok := s.data[requestKey]
+	if !ok {
+		return nil, false
+	}
+
+	return e.backend, true
+}
+
+// objectShard returns the object shard of the session.
+func (m *ReqCache[K, T]) objectShard(requestKey uint64) *objectShard[T] {
+	return m.objectShards[requestKey%uint64(len(m.objectShards))]
+}
+
+// sessionShard returns the session shard of the session.
+func (m *ReqCache[K, T]) sessionShard(requestKey uint64) *sessionShard[K, T] {
+	return m.sessionShards[requestKey%uint64(len(m.sessionShards))]
+}
+
+// lookupSession returns the state of the session if it is registered as a session using the cache.
+func (m *ReqCache[K, T]) lookupSession(requestKey uint64) (*sessionState[K, T], bool) {
+	shard := m.sessionShard(requestKey)
+	shard.mu.Lock()
+	s, ok := shard.sessions[requestKey]
+	shard.mu.Unlock()
+
+	return s, ok
+}
+
+// sessionObjectsIfAny returns the object pool of the session if it has created objects.
+func (m *ReqCache[K, T]) sessionObjectsIfAny(requestKey uint64) (*objectPool[T], bool) {
+	shard := m.objectShard(requestKey)
+	shard.mu.Lock()
+	p, ok := shard.objects[requestKey]
+	shard.mu.Unlock()
+
+	return p, ok
+}
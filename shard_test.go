@@ -0,0 +1,58 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// withShards sets the number of data and object shards.
+func withShards(n int) Option {
+	return func(c *options) {
+		c.shards = n
+	}
+}
+
+func TestReqCache_Shards(t *testing.T) {
+	t.Parallel()
+
+	for _, shards := range []int{1, 4} {
+		cache := New[int, reqCacheTestObject](0, 10, withShards(shards))
+		require.Len(t, cache.dataShards, shards)
+		require.Len(t, cache.objectShards, shards)
+
+		ctxs := make([]context.Context, 8)
+		for i := range ctxs {
+			ctxs[i] = NewSession(context.Background())
+			require.NoError(t, cache.Put(ctxs[i], i, &reqCacheTestObject{value: i}))
+			cache.NewObject(ctxs[i]).value = i
+		}
+
+		for i, ctx := range ctxs {
+			requestKey := fromContext(ctx)
+			require.Contains(t, cache.dataShard(requestKey).data, requestKey)
+			require.Contains(t, cache.objectShard(requestKey).objects, requestKey)
+
+			obj, ok := cache.Get(ctx, i)
+			require.True(t, ok)
+			require.Equal(t, i, obj.value)
+		}
+		require.NoError(t, cache.CheckInvariants())
+
+		for _, ctx := range ctxs {
+			cache.EndSession(ctx)
+		}
+		for _, shard := range cache.dataShards {
+			require.Empty(t, shard.data)
+		}
+		for _, shard := range cache.objectShards {
+			require.Empty(t, shard.objects)
+		}
+	}
+
+	// The default is used if not set
+	cache := New[int, reqCacheTestObject](0, 10)
+	require.Len(t, cache.dataShards, defaultShards)
+	require.Len(t, cache.objectShards, defaultShards)
+}
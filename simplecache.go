@@ -0,0 +1,41 @@
+package reqcache
+
+import "context"
+
+// SimpleCache is a wrapper around ReqCache with one implicit session that lasts as long as the cache,
+// so it is used without NewSession, EndSession and contexts, like a plain LRU cache.
+// It is intended for CLI tools and scripts where request scoping is not needed. It is safe for concurrent use,
+// but all goroutines share the same data.
+type SimpleCache[K comparable, T any] struct {
+	cache *ReqCache[K, T]
+	ctx   context.Context // carries the implicit session
+}
+
+// NewSimple creates a new instance of SimpleCache. size is the maximum number of cached entries.
+// The implicit session is counted by MaxConcurrentSessions as a live session.
+func NewSimple[K comparable, T any](size int) *SimpleCache[K, T] {
+	return &SimpleCache[K, T]{
+		cache: New[K, T](0, size),
+		ctx:   NewSession(context.Background()),
+	}
+}
+
+// Put saves data in the cache.
+func (c *SimpleCache[K, T]) Put(key K, data *T) {
+	_ = c.cache.Put(c.ctx, key, data) // fails only for options SimpleCache doesn't set
+}
+
+// Get returns data from the cache.
+func (c *SimpleCache[K, T]) Get(key K) (*T, bool) {
+	return c.cache.Get(c.ctx, key)
+}
+
+// Exists checks if the data exists in the cache.
+func (c *SimpleCache[K, T]) Exists(key K) bool {
+	return c.cache.Exists(c.ctx, key)
+}
+
+// Delete deletes data from the cache.
+func (c *SimpleCache[K, T]) Delete(key K) bool {
+	return c.cache.Delete(c.ctx, key)
+}
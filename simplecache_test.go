@@ -0,0 +1,32 @@
+package reqcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimpleCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewSimple[string, reqCacheTestObject](2)
+
+	_, ok := cache.Get("key1")
+	require.False(t, ok)
+
+	cache.Put("key1", &reqCacheTestObject{value: 1})
+	cache.Put("key2", &reqCacheTestObject{value: 2})
+
+	v, ok := cache.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	// The least recently used key is evicted
+	cache.Put("key3", &reqCacheTestObject{value: 3})
+	require.False(t, cache.Exists("key2"))
+	require.True(t, cache.Exists("key1"))
+	require.True(t, cache.Exists("key3"))
+
+	require.True(t, cache.Delete("key1"))
+	require.False(t, cache.Exists("key1"))
+}
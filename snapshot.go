@@ -0,0 +1,56 @@
+package reqcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// readSnapshotKey is the context key of the snapshot taken by WithReadSnapshot for the cache.
+type readSnapshotKey[K comparable, T any] struct {
+	cache *ReqCache[K, T]
+}
+
+// readSnapshot contains the session's entries captured by WithReadSnapshot.
+type readSnapshot[K comparable, T any] struct {
+	keys   []K // in the LRU order (oldest first)
+	values []*T
+	index  map[K]*T
+}
+
+// WithReadSnapshot captures the current entries of the session and returns a context bound to them.
+// Get, Exists, KeysInto and the methods reading all entries (Filter, Sorted, Sum and so on) called with the returned
+// context see only the captured entries, even if the session is modified later. Modifying methods called with
+// the returned context change the live session. Only the set of entries is captured: the values are shared
+// with the live session, so changes made inside the objects are visible through the snapshot.
+// The snapshot is bound to this cache only and doesn't update the recency of the entries.
+func (m *ReqCache[K, T]) WithReadSnapshot(ctx context.Context) (context.Context, error) {
+	keys, values, err := m.entries(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	index := make(map[K]*T, len(keys))
+	for i, k := range keys {
+		index[k] = values[i]
+	}
+
+	atomic.StoreUint32(&m.hasSnapshots, 1)
+
+	return context.WithValue(ctx, readSnapshotKey[K, T]{cache: m}, &readSnapshot[K, T]{
+		keys:   keys,
+		values: values,
+		index:  index,
+	}), nil
+}
+
+// readSnapshot returns the snapshot bound to the context by WithReadSnapshot.
+func (m *ReqCache[K, T]) readSnapshot(ctx context.Context) (*readSnapshot[K, T], bool) {
+	// avoid looking up the context if no snapshot was ever taken
+	if atomic.LoadUint32(&m.hasSnapshots) == 0 {
+		return nil, false
+	}
+
+	s, ok := ctx.Value(readSnapshotKey[K, T]{cache: m}).(*readSnapshot[K, T])
+
+	return s, ok
+}
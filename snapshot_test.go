@@ -0,0 +1,90 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_WithReadSnapshot(t *testing.T) {
+	t.Parallel()
+
+	cache := New[string, reqCacheTestObject](0, 10)
+
+	_, err := cache.WithReadSnapshot(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	value1 := &reqCacheTestObject{value: 1}
+	require.NoError(t, cache.Put(ctx, "key1", value1))
+	require.NoError(t, cache.Put(ctx, "key2", &reqCacheTestObject{value: 2}))
+
+	snapshotCtx, err := cache.WithReadSnapshot(ctx)
+	require.NoError(t, err)
+
+	// Writes through both contexts go to the live session
+	require.NoError(t, cache.Put(ctx, "key3", &reqCacheTestObject{value: 3}))
+	require.NoError(t, cache.Put(snapshotCtx, "key4", &reqCacheTestObject{value: 4}))
+	require.True(t, cache.Delete(ctx, "key1"))
+
+	require.True(t, cache.Exists(ctx, "key4"))
+	require.False(t, cache.Exists(ctx, "key1"))
+
+	// The snapshot doesn't observe them
+	v, ok := cache.Get(snapshotCtx, "key1")
+	require.True(t, ok)
+	require.Same(t, value1, v)
+	require.False(t, cache.Exists(snapshotCtx, "key3"))
+	require.False(t, cache.Exists(snapshotCtx, "key4"))
+
+	keys, err := cache.KeysInto(snapshotCtx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"key1", "key2"}, keys)
+
+	sum, err := Sum(snapshotCtx, cache, func(v *reqCacheTestObject) float64 { return float64(v.value) })
+	require.NoError(t, err)
+	require.InDelta(t, 3.0, sum, 1e-9)
+
+	// The snapshot is bound to the cache it was taken from
+	other := New[string, reqCacheTestObject](0, 10)
+	defer other.EndSession(ctx)
+	require.NoError(t, other.Put(ctx, "key5", &reqCacheTestObject{}))
+	require.True(t, other.Exists(snapshotCtx, "key5"))
+}
+
+func TestReqCache_WithReadSnapshotExpiration(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	cache := New[string, reqCacheTestObject](0, 10,
+		WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key", &reqCacheTestObject{value: 1}))
+
+	snapshotCtx, err := cache.WithReadSnapshot(ctx)
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+
+	// The snapshot reports the expired entry as missing, but doesn't delete it from the live session
+	_, ok := cache.Get(snapshotCtx, "key")
+	require.False(t, ok)
+	require.False(t, cache.Exists(snapshotCtx, "key"))
+
+	n, err := cache.Len(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// The live session deletes it
+	require.False(t, cache.Exists(ctx, "key"))
+	n, err = cache.Len(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
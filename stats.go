@@ -0,0 +1,89 @@
+package reqcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Stats contains the counters of a single session, e.g. for a log line at the end of the request.
+type Stats struct {
+	// CacheHits and CacheMisses are the lookup results of the session counted like by HitRatio.
+	CacheHits   uint64
+	CacheMisses uint64
+	// PoolHits is the number of objects created by NewObject in the pre-allocated memory.
+	PoolHits uint64
+	// PoolOverflows is the number of objects allocated because the pre-allocated memory was exhausted.
+	PoolOverflows uint64
+}
+
+// Stats returns the counters of the session. They start from zero for every session and are dropped by EndSession.
+// Every lookup is counted, including the ones made before the session stored any data.
+func (m *ReqCache[K, T]) Stats(ctx context.Context) (Stats, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+
+	if state, ok := m.lookupSession(requestKey); ok {
+		stats.CacheHits, stats.CacheMisses, _ = state.lookups.load()
+	}
+
+	if p, ok := m.sessionObjectsIfAny(requestKey); ok {
+		used, overflow := p.usage()
+		stats.PoolHits, stats.PoolOverflows = uint64(used), uint64(overflow)
+	}
+
+	return stats, nil
+}
+
+// countSessionLookup counts the result of a lookup in the counters of the cache and of the session,
+// registering the session if it hasn't used the cache yet. get is true for the lookups of Get.
+func (m *ReqCache[K, T]) countSessionLookup(ctx context.Context, requestKey uint64, get, hit bool) {
+	m.lookups.count(get, hit)
+	m.trackSession(ctx, requestKey).lookups.count(get, hit)
+}
+
+// countEntryLookup works like countSessionLookup for the session's entry found by the lookup, unless the found data
+// may have expired, which the caller must check before counting the lookup. Returns true if the lookup is counted.
+func (m *ReqCache[K, T]) countEntryLookup(e *sessionData[K, T], get, found, mayExpire bool) bool {
+	if found && mayExpire {
+		return false
+	}
+
+	m.lookups.count(get, found)
+	e.state.lookups.count(get, found)
+
+	return true
+}
+
+// lookupCounters counts the lookups of a session, or of all sessions in ReqCache. The lookups of Get are counted
+// separately from the other ones, so a lookup updates only one counter. It is accessed atomically.
+type lookupCounters struct {
+	getHits   uint64
+	getMisses uint64
+	hits      uint64
+	misses    uint64
+}
+
+// count counts the result of a lookup. get is true for the lookups of Get.
+func (c *lookupCounters) count(get, hit bool) {
+	switch {
+	case get && hit:
+		atomic.AddUint64(&c.getHits, 1)
+	case get:
+		atomic.AddUint64(&c.getMisses, 1)
+	case hit:
+		atomic.AddUint64(&c.hits, 1)
+	default:
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+// load returns the numbers of hits and misses of all lookups and the number of the lookups of Get.
+func (c *lookupCounters) load() (uint64, uint64, uint64) {
+	getHits, getMisses := atomic.LoadUint64(&c.getHits), atomic.LoadUint64(&c.getMisses)
+
+	return getHits + atomic.LoadUint64(&c.hits), getMisses + atomic.LoadUint64(&c.misses), getHits + getMisses
+}
@@ -0,0 +1,53 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](2, 10)
+
+	_, err := cache.Stats(context.Background())
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Stats{}, stats)
+
+	_, _ = cache.Get(ctx, 1) // a miss before anything is stored is counted too
+	require.NoError(t, cache.Put(ctx, 1, &reqCacheTestObject{value: 1}))
+	_, _ = cache.Get(ctx, 1)
+	_, _ = cache.Get(ctx, 2)
+	cache.Exists(ctx, 1)
+	for i := 0; i < 3; i++ {
+		cache.NewObject(ctx)
+	}
+
+	// Another session doesn't affect the counters
+	other := NewSession(context.Background())
+	_, _ = cache.Get(other, 1)
+	require.NoError(t, cache.EndSession(other))
+
+	stats, err = cache.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Stats{CacheHits: 2, CacheMisses: 2, PoolHits: 2, PoolOverflows: 1}, stats)
+
+	require.NoError(t, cache.EndSession(ctx))
+
+	stats, err = cache.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Stats{}, stats)
+
+	// The context of the ended session doesn't leave counters behind
+	_, _ = cache.Get(ctx, 1)
+	stats, err = cache.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Stats{}, stats)
+}
@@ -0,0 +1,133 @@
+package reqcache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestReqCache_Stress runs random operations of concurrent sessions on the same cache, some of the sessions being
+// shared by several goroutines, to be run under the race detector.
+func TestReqCache_Stress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "default", opts: nil},
+		{name: "tracking", opts: []Option{WithEfficiencyTracking(), WithOperationRecording(), WithAutoEndOnEmpty()}},
+		{name: "lock-free", opts: []Option{WithLockFreeSessionMap(), WithAutoGrow(32)}},
+		{name: "pools", opts: []Option{WithBatchedPoolReturns(), WithOverflowPool(), WithOnFirstOverflow(
+			func(context.Context, string, uint64) {})}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stress(t, New[int, reqCacheTestObject](4, 8, tt.opts...))
+		})
+	}
+}
+
+// stress runs random operations of concurrent sessions on the cache.
+func stress(t *testing.T, cache *ReqCache[int, reqCacheTestObject]) {
+	t.Helper()
+
+	const (
+		nWorkers   = 8
+		nSessions  = 20
+		nOps       = 100
+		nKeys      = 20
+		nGoroutine = 3 // goroutines sharing a session
+	)
+
+	fetcher := func(key int) func(context.Context) (*reqCacheTestObject, error) {
+		return func(context.Context) (*reqCacheTestObject, error) {
+			return &reqCacheTestObject{value: key}, nil
+		}
+	}
+
+	// the methods reading the whole cache run concurrently with the sessions
+	done := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				cache.SessionsSnapshot()
+				cache.PoolDiagnostics()
+				cache.PoolMissCount()
+				cache.HitRatio()
+				_ = cache.CheckInvariants() // may report transient states
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < nWorkers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			for s := 0; s < nSessions; s++ {
+				ctx := NewSession(context.Background())
+
+				var sessionWG sync.WaitGroup
+				for g := 0; g < nGoroutine; g++ {
+					sessionWG.Add(1)
+					go func(rnd *rand.Rand) {
+						defer sessionWG.Done()
+
+						for i := 0; i < nOps; i++ {
+							key := rnd.Intn(nKeys)
+							switch rnd.Intn(8) {
+							case 0:
+								_ = cache.Put(ctx, key, &reqCacheTestObject{value: key})
+							case 1:
+								if obj, ok := cache.Get(ctx, key); ok && obj != nil && obj.value != key {
+									t.Errorf("unexpected value %d for key %d", obj.value, key)
+								}
+							case 2:
+								cache.Delete(ctx, key)
+							case 3:
+								obj, err := cache.GetOrFetch(ctx, key, fetcher(key))
+								if err != nil || obj.value != key {
+									t.Errorf("unexpected fetch result %v, %v for key %d", obj, err, key)
+								}
+							case 4:
+								cache.NewObject(ctx).value = key
+							case 5:
+								cache.Exists(ctx, key)
+							case 6:
+								_, _, _ = cache.GetOrPut(ctx, key, &reqCacheTestObject{value: key})
+							case 7:
+								if rnd.Intn(2) == 0 {
+									_ = cache.PutTagged(ctx, key, &reqCacheTestObject{value: key}, "tag")
+								} else {
+									_, _ = cache.InvalidateTag(ctx, "tag")
+								}
+							}
+						}
+					}(rand.New(rand.NewSource(seed + int64(s*nGoroutine+g)))) //nolint:gosec // test data
+				}
+				sessionWG.Wait()
+
+				require.NoError(t, cache.EndSession(ctx))
+			}
+		}(int64(w * nSessions * nGoroutine))
+	}
+	wg.Wait()
+	close(done)
+	<-monitorDone
+
+	require.NoError(t, cache.CheckInvariants())
+	require.Empty(t, cache.SessionsSnapshot())
+}
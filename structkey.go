@@ -0,0 +1,56 @@
+package reqcache
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// structKeyTag is the struct tag that excludes a key field from the key equality when WithStructKeyNormalization is set.
+const structKeyTag = "reqcache"
+
+// WithStructKeyNormalization makes struct keys equal if they differ only in the fields
+// tagged with `reqcache:"-"`. The key is normalized by setting these fields to zero values before every operation,
+// so KeysInto and Filter return the normalized keys.
+// Only exported fields of the key struct itself (not of nested structs) can be excluded.
+// The normalization uses reflection, which costs an allocation and some hundreds of nanoseconds per operation.
+// New panics if the key type is not a struct or an excluded field is unexported.
+func WithStructKeyNormalization() Option {
+	return func(c *options) {
+		c.structKeyNormalization = true
+	}
+}
+
+// excludedKeyFields returns the indexes of the fields of the struct key type excluded from the key equality.
+// Panics if the type is not a struct or an excluded field is unexported.
+func excludedKeyFields(keyType reflect.Type) []int {
+	if keyType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("struct key normalization requires a struct key, got %s", keyType))
+	}
+
+	var fields []int
+	for i := 0; i < keyType.NumField(); i++ {
+		f := keyType.Field(i)
+		if f.Tag.Get(structKeyTag) != "-" {
+			continue
+		}
+
+		if f.PkgPath != "" {
+			panic(fmt.Sprintf("unexported field %s of %s can't be excluded from the key", f.Name, keyType))
+		}
+
+		fields = append(fields, i)
+	}
+
+	return fields
+}
+
+// normalizeStructKey returns a copy of the key with the given fields set to zero values.
+func normalizeStructKey[K comparable](key K, fields []int) K {
+	v := reflect.ValueOf(&key).Elem()
+	for _, i := range fields {
+		f := v.Field(i)
+		f.Set(reflect.Zero(f.Type()))
+	}
+
+	return key
+}
@@ -0,0 +1,51 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type structKeyTestKey struct {
+	ID      int
+	Locale  string
+	TraceID string `reqcache:"-"`
+}
+
+func TestReqCache_StructKeyNormalization(t *testing.T) {
+	t.Parallel()
+
+	cache := New[structKeyTestKey, reqCacheTestObject](0, 10, WithStructKeyNormalization())
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	value := &reqCacheTestObject{value: 1}
+	require.NoError(t, cache.Put(ctx, structKeyTestKey{ID: 1, Locale: "en", TraceID: "a"}, value))
+
+	// Differs only in the excluded field
+	v, ok := cache.Get(ctx, structKeyTestKey{ID: 1, Locale: "en", TraceID: "b"})
+	require.True(t, ok)
+	require.Same(t, value, v)
+
+	// Differs in a regular field
+	require.False(t, cache.Exists(ctx, structKeyTestKey{ID: 1, Locale: "de", TraceID: "a"}))
+
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []structKeyTestKey{{ID: 1, Locale: "en"}}, keys)
+
+	require.True(t, cache.Delete(ctx, structKeyTestKey{ID: 1, Locale: "en", TraceID: "c"}))
+
+	require.Panics(t, func() {
+		New[string, reqCacheTestObject](0, 10, WithStructKeyNormalization())
+	})
+	require.Panics(t, func() {
+		type key struct {
+			id    int
+			trace string `reqcache:"-"`
+		}
+		New[key, reqCacheTestObject](0, 10, WithStructKeyNormalization())
+	})
+}
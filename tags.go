@@ -0,0 +1,100 @@
+package reqcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// PutTagged saves data in the cache like Put and marks the key with the tags,
+// so all keys with a tag can be deleted by InvalidateTag, e.g. after a mutation of the related data.
+// The tags are kept until InvalidateTag or the end of the session: neither Put nor Delete of the key removes them.
+// The tags mark the key as it is stored, after WithContextKeyPrefix and WithStructKeyNormalization are applied.
+func (m *ReqCache[K, T]) PutTagged(ctx context.Context, dataKey K, data *T, tags ...string) error {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Put(ctx, dataKey, data); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	dataKey = m.effectiveKey(ctx, dataKey)
+	state := m.trackSession(ctx, requestKey)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	x := state.extras()
+	if x.tags == nil {
+		x.tags = make(map[string]map[K]struct{})
+	}
+
+	for _, tag := range tags {
+		keys, ok := x.tags[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			x.tags[tag] = keys
+		}
+		keys[dataKey] = struct{}{}
+	}
+
+	return nil
+}
+
+// InvalidateTag deletes all keys marked with the tag by PutTagged and forgets the tag.
+// Returns the number of deleted entries, which doesn't include the keys already deleted or evicted.
+// The entries are deleted like Delete does, but WithOperationRecording doesn't record them as Delete calls.
+func (m *ReqCache[K, T]) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	requestKey, err := sessionFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	state, ok := m.lookupSession(requestKey)
+
+	if !ok {
+		return 0, nil
+	}
+
+	var keys map[K]struct{}
+
+	state.mu.Lock()
+	if state.extra != nil {
+		keys = state.extra.tags[tag]
+		delete(state.extra.tags, tag)
+	}
+	state.mu.Unlock()
+
+	deleted := 0
+	for k := range keys {
+		if m.deleteKey(ctx, requestKey, k) {
+			deleted++
+		}
+		atomic.AddUint64(&m.lifetime.deletes, 1)
+	}
+
+	return deleted, nil
+}
+
+// moveTags marks the to key with the tags of the from key moved by Move instead of the from key.
+// Both keys are effective keys, like the keys stored by PutTagged.
+func (s *sessionState[K, T]) moveTags(from, to K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.extra == nil {
+		return
+	}
+
+	for _, keys := range s.extra.tags {
+		if _, ok := keys[from]; ok {
+			delete(keys, from)
+			keys[to] = struct{}{}
+		}
+	}
+}
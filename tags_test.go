@@ -0,0 +1,102 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_InvalidateTag(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 10)
+
+	_, err := cache.InvalidateTag(context.Background(), "a")
+	require.ErrorIs(t, err, ErrNoSessionInContext)
+	require.ErrorIs(t, cache.PutTagged(context.Background(), 1, &reqCacheTestObject{value: 1}, "a"),
+		ErrNoSessionInContext)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	// No tags in the session yet
+	n, err := cache.InvalidateTag(ctx, "a")
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	require.NoError(t, cache.PutTagged(ctx, 1, &reqCacheTestObject{value: 1}, "a"))
+	require.NoError(t, cache.PutTagged(ctx, 2, &reqCacheTestObject{value: 2}, "a", "b"))
+	require.NoError(t, cache.PutTagged(ctx, 3, &reqCacheTestObject{value: 3}, "b"))
+	require.NoError(t, cache.PutTagged(ctx, 4, &reqCacheTestObject{value: 4}))
+	require.NoError(t, cache.Put(ctx, 5, &reqCacheTestObject{value: 5}))
+
+	n, err = cache.InvalidateTag(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 4, 5}, keys)
+
+	// Already deleted keys are not counted
+	n, err = cache.InvalidateTag(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// The tag is forgotten
+	n, err = cache.InvalidateTag(ctx, "a")
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	keys, err = cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 5}, keys)
+}
+
+func TestReqCache_MoveTagsWithKeyRewriting(t *testing.T) {
+	t.Parallel()
+
+	t.Run("prefix", func(t *testing.T) {
+		t.Parallel()
+
+		cache := New[string, reqCacheTestObject](0, 10, WithContextKeyPrefix[string](func(ctx context.Context) string {
+			tenant, _ := ctx.Value(tenantContextKey{}).(string)
+			return tenant
+		}))
+
+		ctx := NewSession(context.Background())
+		defer cache.EndSession(ctx)
+		ctx = context.WithValue(ctx, tenantContextKey{}, "tenant")
+
+		require.NoError(t, cache.PutTagged(ctx, "from", &reqCacheTestObject{value: 1}, "tag"))
+		moved, err := cache.Move(ctx, "from", "to")
+		require.NoError(t, err)
+		require.True(t, moved)
+
+		// The tag moves with the entry
+		n, err := cache.InvalidateTag(ctx, "tag")
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		require.False(t, cache.Exists(ctx, "to"))
+	})
+
+	t.Run("struct key normalization", func(t *testing.T) {
+		t.Parallel()
+
+		cache := New[structKeyTestKey, reqCacheTestObject](0, 10, WithStructKeyNormalization())
+
+		ctx := NewSession(context.Background())
+		defer cache.EndSession(ctx)
+
+		require.NoError(t, cache.PutTagged(ctx, structKeyTestKey{ID: 1, TraceID: "a"}, &reqCacheTestObject{value: 1}, "tag"))
+		moved, err := cache.Move(ctx, structKeyTestKey{ID: 1, TraceID: "b"}, structKeyTestKey{ID: 2, TraceID: "c"})
+		require.NoError(t, err)
+		require.True(t, moved)
+
+		n, err := cache.InvalidateTag(ctx, "tag")
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		require.False(t, cache.Exists(ctx, structKeyTestKey{ID: 2}))
+	})
+}
@@ -0,0 +1,158 @@
+package reqcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// WithUnbounded disables eviction: the session's storage is a map growing without limit,
+// so every cached key stays in the session until it is deleted or the session ends.
+// cacheSize is ignored and may be 0. Can't be combined with WithBackendFactory.
+func WithUnbounded() Option {
+	return func(c *options) {
+		c.unbounded = true
+	}
+}
+
+// unboundedBackend is the Backend used by WithUnbounded. It never evicts,
+// the list only keeps the keys ordered from the oldest to the newest for Keys.
+type unboundedBackend[K comparable, T any] struct {
+	mu    sync.Mutex // Get updates the recency, so reads are serialized as well
+	items map[K]*list.Element
+	order *list.List // of *unboundedEntry, from the oldest to the newest
+}
+
+// unboundedEntry is an element of unboundedBackend.order.
+type unboundedEntry[K comparable, T any] struct {
+	key   K
+	value *T
+}
+
+// entryOf returns the entry stored in the element of unboundedBackend.order.
+func entryOf[K comparable, T any](e *list.Element) *unboundedEntry[K, T] {
+	entry, _ := e.Value.(*unboundedEntry[K, T])
+
+	return entry
+}
+
+// newUnboundedBackend creates the Backend used by WithUnbounded. The size is used only as the initial capacity.
+func newUnboundedBackend[K comparable, T any](size int) Backend[K, T] {
+	return &unboundedBackend[K, T]{
+		mu:    sync.Mutex{},
+		items: make(map[K]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+// Add adds a value to the storage. It never evicts, so it always returns false.
+func (b *unboundedBackend[K, T]) Add(key K, value *T) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e, ok := b.items[key]; ok {
+		entryOf[K, T](e).value = value
+		b.order.MoveToBack(e)
+
+		return false
+	}
+
+	b.items[key] = b.order.PushBack(&unboundedEntry[K, T]{key: key, value: value})
+
+	return false
+}
+
+// Get returns a value by the key and updates its recency.
+func (b *unboundedBackend[K, T]) Get(key K) (*T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.items[key]
+	if !ok {
+		return nil, false
+	}
+	b.order.MoveToBack(e)
+
+	return entryOf[K, T](e).value, true
+}
+
+// Peek returns a value by the key without updating its recency.
+func (b *unboundedBackend[K, T]) Peek(key K) (*T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	return entryOf[K, T](e).value, true
+}
+
+// Contains checks if the key is in the storage without updating its recency.
+func (b *unboundedBackend[K, T]) Contains(key K) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.items[key]
+
+	return ok
+}
+
+// Remove removes the key from the storage. Returns true if the key was present.
+func (b *unboundedBackend[K, T]) Remove(key K) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.items[key]
+	if !ok {
+		return false
+	}
+	b.order.Remove(e)
+	delete(b.items, key)
+
+	return true
+}
+
+// Purge removes all keys from the storage. The map keeps its memory for the next session.
+func (b *unboundedBackend[K, T]) Purge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for k := range b.items {
+		delete(b.items, k)
+	}
+	b.order.Init()
+}
+
+// Keys returns all keys in the storage, from the oldest to the newest.
+func (b *unboundedBackend[K, T]) Keys() []K {
+	return b.AppendKeys(nil)
+}
+
+// AppendKeys appends the keys to dst, from the oldest to the newest.
+func (b *unboundedBackend[K, T]) AppendKeys(dst []K) []K {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if dst == nil {
+		dst = make([]K, 0, len(b.items))
+	}
+	for e := b.order.Front(); e != nil; e = e.Next() {
+		dst = append(dst, entryOf[K, T](e).key)
+	}
+
+	return dst
+}
+
+// Len returns the number of keys in the storage.
+func (b *unboundedBackend[K, T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.items)
+}
+
+// Resize does nothing, the storage has no capacity. It allows WithoutEviction to be used with WithUnbounded.
+func (b *unboundedBackend[K, T]) Resize(int) int {
+	return 0
+}
@@ -0,0 +1,63 @@
+package reqcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReqCache_Unbounded(t *testing.T) {
+	t.Parallel()
+
+	cache := New[int, reqCacheTestObject](0, 0, WithUnbounded())
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	const count = 1000
+	for i := 0; i < count; i++ {
+		require.NoError(t, cache.Put(ctx, i, &reqCacheTestObject{value: i}))
+	}
+
+	n, err := cache.Len(ctx)
+	require.NoError(t, err)
+	require.Equal(t, count, n, "Nothing must be evicted")
+
+	// The recency is kept for the order of the keys
+	_, ok := cache.Get(ctx, 0)
+	require.True(t, ok)
+	require.True(t, cache.Delete(ctx, 1))
+	keys, err := cache.KeysInto(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, keys, count-1)
+	require.Equal(t, 2, keys[0])
+	require.Equal(t, 0, keys[len(keys)-1])
+
+	obj, err := cache.GetOrFetch(ctx, count, func(context.Context) (*reqCacheTestObject, error) {
+		return &reqCacheTestObject{value: count}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, count, obj.value)
+	require.True(t, cache.Exists(ctx, count))
+
+	require.NoError(t, cache.WithoutEviction(ctx, func() error { return nil }))
+	require.True(t, cache.Exists(ctx, 0))
+
+	// The storage is purged when it is reused
+	require.NoError(t, cache.EndSession(ctx))
+	ctx = NewSession(context.Background())
+	require.False(t, cache.Exists(ctx, 0))
+}
+
+func TestReqCache_UnboundedConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := Builder[int, reqCacheTestObject]().Options(WithUnbounded()).Build()
+	require.NoError(t, err, "cacheSize may be 0")
+
+	require.Panics(t, func() {
+		New[int, reqCacheTestObject](0, 0, WithUnbounded(),
+			WithBackendFactory[int, reqCacheTestObject](newLRUBackend[int, reqCacheTestObject]))
+	})
+}
@@ -0,0 +1,82 @@
+package reqcache
+
+import "context"
+
+// ValueCache is a wrapper around ReqCache that stores values instead of pointers.
+// Put copies the value into the pre-allocated memory and Get returns a copy of the stored value,
+// so callers can modify the results freely without affecting the cache.
+// To modify a stored value in place, use Update or GetPtr.
+type ValueCache[K comparable, T any] struct {
+	cache *ReqCache[K, T]
+}
+
+// NewValueCache creates a new instance of ValueCache. The arguments are the same as for New.
+func NewValueCache[K comparable, T any](objSize, cacheSize int, opts ...Option) *ValueCache[K, T] {
+	return &ValueCache[K, T]{
+		cache: New[K, T](objSize, cacheSize, opts...),
+	}
+}
+
+// Put saves a copy of the value in the cache.
+func (c *ValueCache[K, T]) Put(ctx context.Context, dataKey K, value T) error {
+	obj := c.cache.NewObject(ctx)
+	*obj = value
+
+	return c.cache.Put(ctx, dataKey, obj)
+}
+
+// Get returns a copy of the value from the cache.
+func (c *ValueCache[K, T]) Get(ctx context.Context, dataKey K) (T, bool) {
+	obj, ok := c.cache.Get(ctx, dataKey)
+	if !ok || obj == nil {
+		var zero T
+		return zero, false
+	}
+
+	return *obj, true
+}
+
+// GetPtr returns a pointer to the value stored in the cache, so modifications affect the cached value.
+// If the session is shared by several goroutines, use Update instead to modify the value under the key lock.
+func (c *ValueCache[K, T]) GetPtr(ctx context.Context, dataKey K) (*T, bool) {
+	return c.cache.Get(ctx, dataKey)
+}
+
+// Update calls fn with a pointer to the value stored in the cache, holding a lock of the key.
+// Updates of the same key are serialized. Updates of different keys usually run concurrently, but the keys share
+// a fixed number of locks, so some of them are serialized too. fn must not call Update of the same session,
+// as it can deadlock even for a different key.
+// Returns false if there is no value for the key.
+func (c *ValueCache[K, T]) Update(ctx context.Context, dataKey K, fn func(value *T)) (bool, error) {
+	lock, err := c.cache.keyLock(ctx, dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	obj, ok := c.cache.Get(ctx, dataKey)
+	if !ok || obj == nil {
+		return false, nil
+	}
+
+	fn(obj)
+
+	return true, nil
+}
+
+// Exists checks if the value exists in the cache.
+func (c *ValueCache[K, T]) Exists(ctx context.Context, dataKey K) bool {
+	return c.cache.Exists(ctx, dataKey)
+}
+
+// Delete deletes the value from the cache.
+func (c *ValueCache[K, T]) Delete(ctx context.Context, dataKey K) bool {
+	return c.cache.Delete(ctx, dataKey)
+}
+
+// EndSession deletes the session's values from the cache. See ReqCache.EndSession.
+func (c *ValueCache[K, T]) EndSession(ctx context.Context) error {
+	return c.cache.EndSession(ctx)
+}
@@ -0,0 +1,131 @@
+package reqcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewValueCache[string, reqCacheTestObject](10, 10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	value := reqCacheTestObject{value: 1}
+	require.NoError(t, cache.Put(ctx, "key", value))
+
+	// The stored value is a copy
+	value.value = 2
+	v, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	// Modifying the result of Get doesn't affect the cache
+	v.value = 3
+	v, ok = cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v.value)
+
+	// Modifications under Update do
+	updated, err := cache.Update(ctx, "key", func(v *reqCacheTestObject) { v.value = 4 })
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	v, ok = cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 4, v.value)
+
+	// Modifications via GetPtr do too
+	ptr, ok := cache.GetPtr(ctx, "key")
+	require.True(t, ok)
+	ptr.value = 5
+
+	v, ok = cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, 5, v.value)
+
+	updated, err = cache.Update(ctx, "missing", func(*reqCacheTestObject) {})
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	_, ok = cache.Get(ctx, "missing")
+	require.False(t, ok)
+
+	require.True(t, cache.Delete(ctx, "key"))
+	require.False(t, cache.Exists(ctx, "key"))
+}
+
+func TestValueCache_UpdateKeyLocks(t *testing.T) {
+	t.Parallel()
+
+	cache := NewValueCache[string, reqCacheTestObject](10, 10)
+
+	ctx := NewSession(context.Background())
+	defer cache.EndSession(ctx)
+
+	require.NoError(t, cache.Put(ctx, "key", reqCacheTestObject{}))
+
+	// Updates of the same key are serialized
+	const nParallel = 20
+	var wg sync.WaitGroup
+	for i := 0; i < nParallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := cache.Update(ctx, "key", func(v *reqCacheTestObject) { v.value++ }); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, ok := cache.Get(ctx, "key")
+	require.True(t, ok)
+	require.Equal(t, nParallel, v.value)
+
+	// Equal keys share the lock, keys of different stripes have different locks
+	lock, err := cache.cache.keyLock(ctx, "key")
+	require.NoError(t, err)
+	same, err := cache.cache.keyLock(ctx, "key")
+	require.NoError(t, err)
+	require.Same(t, lock, same)
+
+	const other = "other"
+	require.NotEqual(t, keyLockStripe("key"), keyLockStripe(other))
+	otherLock, err := cache.cache.keyLock(ctx, other)
+	require.NoError(t, err)
+	require.NotSame(t, lock, otherLock)
+
+	require.NoError(t, cache.Put(ctx, other, reqCacheTestObject{}))
+
+	// An update of another key isn't blocked by a running update
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_, _ = cache.Update(ctx, "key", func(*reqCacheTestObject) {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = cache.Update(ctx, other, func(v *reqCacheTestObject) { v.value = 1 })
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("update of another key is blocked")
+	}
+	close(release)
+}